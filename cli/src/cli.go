@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 
 	docker "github.com/pubg/kube-image-deployer/remoteRegistry/docker"
 )
@@ -20,8 +21,23 @@ func init() {
 	flag.Parse()
 }
 
+// commands subcommands. Without a subcommand the image digest of --image, --tag is printed
+var commands = map[string]func(args []string) error{
+	"history":  history,
+	"rollback": rollback,
+	"enable":   enable,
+}
+
 func main() {
 
+	if command, ok := commands[flag.Arg(0)]; ok {
+		if err := command(flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if image == "" || tag == "" {
 		flag.Usage()
 		return
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/util"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// getContainer returns the container (or initContainer) of the workload
+func getContainer(obj runtime.Object, name string) (container coreV1.Container, isInitContainer bool, err error) {
+	if container, err := util.GetContainerByName(obj, name); err == nil {
+		return container, false, nil
+	}
+	if container, err := util.GetInitContainerByName(obj, name); err == nil {
+		return container, true, nil
+	}
+	return coreV1.Container{}, false, fmt.Errorf("container %s not found", name)
+}
+
+// history prints the image history of a container
+func history(args []string) error {
+	w := &workloadFlags{}
+	fs := newWorkloadFlagSet("history", w)
+	fs.Parse(args)
+	if err := w.validate(); err != nil {
+		fs.Usage()
+		return err
+	}
+
+	ctx := context.Background()
+	clientset, err := newClientset(w.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	obj, err := getWorkload(ctx, clientset, w)
+	if err != nil {
+		return err
+	}
+
+	container, _, err := getContainer(obj, w.container)
+	if err != nil {
+		return err
+	}
+
+	annotations, _ := util.GetAnnotations(obj)
+	entries, err := util.ParseHistory(annotations[w.watchKey+util.HistoryAnnotation+w.container])
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "INDEX\tREPLACED AT\tIMAGE\n")
+	fmt.Fprintf(tw, "current\t\t%s\n", container.Image)
+	for i, entry := range entries {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", i, entry.Time.Format(time.RFC3339), entry.Image)
+	}
+	tw.Flush()
+
+	if reason := annotations[w.watchKey+util.DisabledAnnotation+w.container]; reason != "" {
+		fmt.Printf("\ncontainer %s is not tracked by kube-image-deployer (%s). Run 'enable' to track it again.\n", w.container, reason)
+	}
+	return nil
+}
+
+// rollback restores an image from the history and stops tracking the container
+func rollback(args []string) error {
+	w := &workloadFlags{}
+	fs := newWorkloadFlagSet("rollback", w)
+	index := fs.Int("index", 0, "history index to roll back to. see 'history'")
+	fs.Parse(args)
+	if err := w.validate(); err != nil {
+		fs.Usage()
+		return err
+	}
+
+	ctx := context.Background()
+	clientset, err := newClientset(w.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	obj, err := getWorkload(ctx, clientset, w)
+	if err != nil {
+		return err
+	}
+
+	container, isInitContainer, err := getContainer(obj, w.container)
+	if err != nil {
+		return err
+	}
+
+	historyKey := w.watchKey + util.HistoryAnnotation + w.container
+	annotations, _ := util.GetAnnotations(obj)
+	entries, err := util.ParseHistory(annotations[historyKey])
+	if err != nil {
+		return err
+	}
+
+	if *index < 0 || *index >= len(entries) {
+		return fmt.Errorf("history index %d out of range, %d entries", *index, len(entries))
+	}
+
+	image := entries[*index].Image
+	containers := []util.Container{{Name: w.container, Image: image}}
+	patchAnnotations := map[string]string{
+		historyKey: util.AppendHistory(annotations[historyKey], container.Image, time.Now()), // roll forward
+		w.watchKey + util.DisabledAnnotation + w.container: "rollback at " + time.Now().UTC().Format(time.RFC3339),
+	}
+
+	var data []byte
+	if isInitContainer {
+		data, err = util.GetImageStrategicPatchJson(obj, nil, containers, patchAnnotations)
+	} else {
+		data, err = util.GetImageStrategicPatchJson(obj, containers, nil, patchAnnotations)
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.isJob() {
+		err = recreateJob(ctx, clientset, w, data)
+	} else {
+		err = patchWorkload(ctx, clientset, w, types.StrategicMergePatchType, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s/%s container %s rolled back to %s\n", w.namespace, w.name, w.container, image)
+	fmt.Printf("container %s is not tracked by kube-image-deployer until 'enable' is run\n", w.container)
+	return nil
+}
+
+// enable removes the disabled annotation so that the container is tracked again
+func enable(args []string) error {
+	w := &workloadFlags{}
+	fs := newWorkloadFlagSet("enable", w)
+	fs.Parse(args)
+	if err := w.validate(); err != nil {
+		fs.Usage()
+		return err
+	}
+
+	ctx := context.Background()
+	clientset, err := newClientset(w.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				w.watchKey + util.DisabledAnnotation + w.container: nil,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := patchWorkload(ctx, clientset, w, types.MergePatchType, data); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s/%s container %s is tracked by kube-image-deployer\n", w.namespace, w.name, w.container)
+	return nil
+}
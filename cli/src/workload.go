@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pubg/kube-image-deployer/util"
+	batchV1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workloadFlags flags to select a container of a workload
+type workloadFlags struct {
+	kubeconfig string
+	kind       string
+	namespace  string
+	name       string
+	container  string
+	watchKey   string
+
+	cronJobVersion string
+}
+
+func newWorkloadFlagSet(command string, w *workloadFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.StringVar(&w.kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file. default=$HOME/.kube/config")
+	fs.StringVar(&w.kind, "kind", "deployment", "workload kind. deployment, statefulset, daemonset, cronjob, job, replicaset")
+	fs.StringVar(&w.namespace, "namespace", "default", "workload namespace")
+	fs.StringVar(&w.name, "name", "", "workload name")
+	fs.StringVar(&w.container, "container", "", "container name")
+	fs.StringVar(&w.watchKey, "watch-key", "kube-image-deployer", "controller watch key")
+	fs.StringVar(&w.cronJobVersion, "cronjob-version", "", "CronJob API version. v1, v1beta1. If empty, detected by API discovery")
+	return fs
+}
+
+func (w *workloadFlags) validate() error {
+	if w.name == "" || w.container == "" {
+		return fmt.Errorf("--name and --container are required")
+	}
+	if w.cronJobVersion != "" && w.cronJobVersion != util.CronJobV1 && w.cronJobVersion != util.CronJobV1beta1 {
+		return fmt.Errorf("unsupported --cronjob-version %s", w.cronJobVersion)
+	}
+	return nil
+}
+
+func newClientset(kubeconfig string) (*kubernetes.Clientset, error) {
+	if kubeconfig == "" {
+		if config, err := rest.InClusterConfig(); err == nil {
+			return kubernetes.NewForConfig(config)
+		}
+		if home, _ := os.UserHomeDir(); home != "" {
+			kubeconfig = home + "/.kube/config"
+		}
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// isCronJobV1beta1 returns true if CronJobs are served in batch/v1beta1. If --cronjob-version is empty, it is detected by API discovery
+func (w *workloadFlags) isCronJobV1beta1(clientset *kubernetes.Clientset) (bool, error) {
+	if w.cronJobVersion == "" {
+		version, err := util.DetectCronJobVersion(clientset.Discovery())
+		if err != nil {
+			return false, err
+		}
+		w.cronJobVersion = version
+	}
+	return w.cronJobVersion == util.CronJobV1beta1, nil
+}
+
+// getWorkload returns the workload selected by the flags
+func getWorkload(ctx context.Context, clientset *kubernetes.Clientset, w *workloadFlags) (runtime.Object, error) {
+	switch w.kind {
+	case "deployment", "deployments":
+		return clientset.AppsV1().Deployments(w.namespace).Get(ctx, w.name, metaV1.GetOptions{})
+	case "statefulset", "statefulsets":
+		return clientset.AppsV1().StatefulSets(w.namespace).Get(ctx, w.name, metaV1.GetOptions{})
+	case "daemonset", "daemonsets":
+		return clientset.AppsV1().DaemonSets(w.namespace).Get(ctx, w.name, metaV1.GetOptions{})
+	case "cronjob", "cronjobs":
+		if v1beta1, err := w.isCronJobV1beta1(clientset); err != nil {
+			return nil, err
+		} else if v1beta1 {
+			return clientset.BatchV1beta1().CronJobs(w.namespace).Get(ctx, w.name, metaV1.GetOptions{})
+		}
+		return clientset.BatchV1().CronJobs(w.namespace).Get(ctx, w.name, metaV1.GetOptions{})
+	case "job", "jobs":
+		return clientset.BatchV1().Jobs(w.namespace).Get(ctx, w.name, metaV1.GetOptions{})
+	case "replicaset", "replicasets":
+		return clientset.AppsV1().ReplicaSets(w.namespace).Get(ctx, w.name, metaV1.GetOptions{})
+	}
+	return nil, fmt.Errorf("unsupported kind %s", w.kind)
+}
+
+// patchWorkload patches the workload selected by the flags
+func patchWorkload(ctx context.Context, clientset *kubernetes.Clientset, w *workloadFlags, patchType types.PatchType, data []byte) error {
+	var err error
+	switch w.kind {
+	case "deployment", "deployments":
+		_, err = clientset.AppsV1().Deployments(w.namespace).Patch(ctx, w.name, patchType, data, metaV1.PatchOptions{})
+	case "statefulset", "statefulsets":
+		_, err = clientset.AppsV1().StatefulSets(w.namespace).Patch(ctx, w.name, patchType, data, metaV1.PatchOptions{})
+	case "daemonset", "daemonsets":
+		_, err = clientset.AppsV1().DaemonSets(w.namespace).Patch(ctx, w.name, patchType, data, metaV1.PatchOptions{})
+	case "cronjob", "cronjobs":
+		var v1beta1 bool
+		if v1beta1, err = w.isCronJobV1beta1(clientset); err != nil {
+			return err
+		} else if v1beta1 {
+			_, err = clientset.BatchV1beta1().CronJobs(w.namespace).Patch(ctx, w.name, patchType, data, metaV1.PatchOptions{})
+		} else {
+			_, err = clientset.BatchV1().CronJobs(w.namespace).Patch(ctx, w.name, patchType, data, metaV1.PatchOptions{})
+		}
+	case "job", "jobs":
+		_, err = clientset.BatchV1().Jobs(w.namespace).Patch(ctx, w.name, patchType, data, metaV1.PatchOptions{})
+	case "replicaset", "replicasets":
+		_, err = clientset.AppsV1().ReplicaSets(w.namespace).Patch(ctx, w.name, patchType, data, metaV1.PatchOptions{})
+	default:
+		err = fmt.Errorf("unsupported kind %s", w.kind)
+	}
+	return err
+}
+
+// isJob returns true if the flags select a Job
+func (w *workloadFlags) isJob() bool {
+	return w.kind == "job" || w.kind == "jobs"
+}
+
+// recreateJob applies the strategic merge patch to the Job and creates it again, because the pod template of a Job is immutable
+func recreateJob(ctx context.Context, clientset *kubernetes.Clientset, w *workloadFlags, data []byte) error {
+	jobs := clientset.BatchV1().Jobs(w.namespace)
+	job, err := jobs.Get(ctx, w.name, metaV1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	patched := &batchV1.Job{}
+	if err := util.ApplyPatchLocally(job, data, patched); err != nil {
+		return err
+	}
+	util.CleanJobForRecreate(patched)
+
+	return util.Recreate(ctx, job.UID, false,
+		func(options metaV1.DeleteOptions) error { return jobs.Delete(ctx, w.name, options) },
+		func() error { _, err := jobs.Get(ctx, w.name, metaV1.GetOptions{}); return err },
+		func() error { _, err := jobs.Create(ctx, patched, metaV1.CreateOptions{}); return err },
+	)
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"github.com/pubg/kube-image-deployer/util"
+)
+
+// getAnnotations workload의 annotation에 annotationSource(ImagePolicy)가 제공하는 annotation을 합쳐서 반환한다.
+// workload에 직접 지정한 annotation이 우선한다.
+func (c *Controller) getAnnotations(obj interface{}) (map[string]string, error) {
+	annotations, err := util.GetAnnotations(obj)
+	if err != nil || c.annotationSource == nil {
+		return annotations, err
+	}
+
+	merged := c.annotationSource.GetAnnotations(c.resource, obj)
+	for key, value := range annotations {
+		merged[key] = value
+	}
+	return merged, nil
+}
+
+// ResyncAll informer cache의 모든 workload를 다시 동기화한다. ImagePolicy가 변경된 경우 호출한다.
+func (c *Controller) ResyncAll() {
+	for _, key := range c.indexer.ListKeys() {
+		c.queue.Add(key)
+	}
+}
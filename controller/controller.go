@@ -3,6 +3,7 @@ package controller
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pubg/kube-image-deployer/interfaces"
@@ -11,6 +12,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
@@ -24,6 +26,10 @@ type Controller struct {
 	imageNotifier            interfaces.IImageNotifier
 	applyStrategicMergePatch ApplyStrategicMergePatch
 	logger                   interfaces.ILogger
+	recorder                 record.EventRecorder
+	rolloutDeadline          time.Duration
+	dryRun                   bool
+	annotationSource         interfaces.IAnnotationSource
 
 	syncedImages      map[Image]bool
 	syncedImagesMutex sync.RWMutex
@@ -31,10 +37,24 @@ type Controller struct {
 	imageUpdateNotifyList      []imageUpdateNotify
 	imageUpdateNotifyListMutex sync.RWMutex
 
+	rollouts      map[string]*rollout // key별 완료를 기다리는 rollout
+	rolloutsMutex sync.Mutex
+
+	pendingPatches      map[string]map[string]patch // 보류된 patch. key -> containerName -> patch
+	pendingRetryAt      map[string]time.Time        // 적용에 실패한 pending patch를 다시 시도할 시간
+	pendingPatchesMutex sync.Mutex
+
+	seenImages      map[imageKey]seenImage // tag별 image string이 처음 관찰된 시간. min-age에 사용한다.
+	seenImagesMutex sync.Mutex
+
+
 	watchKey string
+
+	synced int32 // informer cache sync 완료 여부
 }
 
-type ApplyStrategicMergePatch func(namespace, name string, data []byte) error
+// ApplyStrategicMergePatch patches the workload. If dryRun, the patch is validated but not persisted
+type ApplyStrategicMergePatch func(namespace, name string, data []byte, dryRun bool) error
 
 type ControllerOpt struct {
 	Resource                 string
@@ -46,10 +66,19 @@ type ControllerOpt struct {
 	ApplyStrategicMergePatch ApplyStrategicMergePatch
 	ControllerWatchKey       string
 	Logger                   interfaces.ILogger
+	Recorder                 record.EventRecorder         // records Kubernetes Events on the workloads. If nil, events are dropped
+	RolloutDeadline          time.Duration                // rolls back a patch whose rollout does not complete in time. If 0, disabled unless annotated
+	DryRun                   bool                         // computes patches without persisting them, unless overridden by annotation
+	AnnotationSource         interfaces.IAnnotationSource // provides annotations from outside the workloads (ImagePolicy). If nil, only workload annotations are used
 }
 
 // NewController creates a new Controller.
 func NewController(opt ControllerOpt) *Controller {
+	recorder := opt.Recorder
+	if recorder == nil {
+		recorder = &record.FakeRecorder{}
+	}
+
 	return &Controller{
 		resource:                   opt.Resource,
 		objType:                    opt.ObjType,
@@ -60,10 +89,21 @@ func NewController(opt ControllerOpt) *Controller {
 		applyStrategicMergePatch:   opt.ApplyStrategicMergePatch,
 		watchKey:                   opt.ControllerWatchKey,
 		logger:                     opt.Logger,
+		recorder:                   recorder,
+		rolloutDeadline:            opt.RolloutDeadline,
+		dryRun:                     opt.DryRun,
+		annotationSource:           opt.AnnotationSource,
 		syncedImages:               make(map[Image]bool),
 		syncedImagesMutex:          sync.RWMutex{},
 		imageUpdateNotifyList:      make([]imageUpdateNotify, 0),
 		imageUpdateNotifyListMutex: sync.RWMutex{},
+		rollouts:                   make(map[string]*rollout),
+		rolloutsMutex:              sync.Mutex{},
+		pendingPatches:             make(map[string]map[string]patch),
+		pendingRetryAt:             make(map[string]time.Time),
+		pendingPatchesMutex:        sync.Mutex{},
+		seenImages:                 make(map[imageKey]seenImage),
+		seenImagesMutex:            sync.Mutex{},
 	}
 }
 
@@ -126,12 +166,14 @@ func (c *Controller) Run(workers int, stopCh chan struct{}) {
 		runtime.HandleError(fmt.Errorf("[%s] : Timed out waiting for caches to sync", c.resource))
 		return
 	}
+	atomic.StoreInt32(&c.synced, 1)
 
 	for i := 0; i < workers; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
 
 	go wait.Until(c.patchUpdateNotifyList, time.Second, stopCh)
+	go wait.Until(c.checkRollouts, time.Second, stopCh)
 
 	<-stopCh
 	c.logger.Infof("[%s] Stopping controller", c.resource)
@@ -141,6 +183,11 @@ func (c *Controller) GetReresourceName() string {
 	return c.resource
 }
 
+// HasSynced returns true once the informer cache has been synced
+func (c *Controller) HasSynced() bool {
+	return atomic.LoadInt32(&c.synced) == 1
+}
+
 func (c *Controller) runWorker() {
 	for c.processNextItem() {
 	}
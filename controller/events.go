@@ -0,0 +1,26 @@
+package controller
+
+import (
+	pkgRuntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// Kubernetes Event reasons recorded on the workloads
+const (
+	EventReasonImageUpdated       = "ImageUpdated"
+	EventReasonImageUpdateFailed  = "ImageUpdateFailed"
+	EventReasonImageUpdateDryRun  = "ImageUpdateDryRun"
+	EventReasonImageUpdatePending = "ImageUpdatePending"
+	EventReasonContainerNotFound  = "ContainerNotFound"
+	EventReasonRolloutFailed      = "RolloutFailed"
+	EventReasonRollbackFailed     = "RollbackFailed"
+)
+
+// recordEventf workload에 Kubernetes Event를 기록한다. eventType은 v1.EventTypeNormal, v1.EventTypeWarning
+func (c *Controller) recordEventf(obj interface{}, eventType, reason, messageFmt string, args ...interface{}) {
+	object, ok := obj.(pkgRuntime.Object)
+	if !ok {
+		c.logger.Errorf("[%s] recordEventf invalid object type=%T\n", c.resource, obj)
+		return
+	}
+	c.recorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
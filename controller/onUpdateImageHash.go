@@ -2,7 +2,10 @@ package controller
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/pubg/kube-image-deployer/metrics"
 	"github.com/pubg/kube-image-deployer/util"
 	v1 "k8s.io/api/core/v1"
 )
@@ -12,12 +15,14 @@ type patch struct {
 	containerName string
 	url           string
 	tag           string
+	platform      string
 	imageString   string
 }
 
 type imageUpdateNotify struct {
 	url         string
 	tag         string
+	platform    string
 	imageString string
 }
 
@@ -26,14 +31,15 @@ func (c *Controller) getPatchMapByUpdates(updates []imageUpdateNotify) map[strin
 	patchMap := make(map[string][]patch)
 
 	for _, update := range updates {
-		c.logger.Infof("[%s] OnUpdateImageString %s, %s, %s", c.resource, update.url, update.tag, update.imageString)
+		c.logger.Infof("[%s] OnUpdateImageString %s, %s, %s, %s", c.resource, update.url, update.tag, update.platform, update.imageString)
+		c.observeImage(update)
 
 		c.syncedImagesMutex.RLock()
 		defer c.syncedImagesMutex.RUnlock()
 
 		for image := range c.syncedImages {
 
-			if image.url != update.url || image.tag != update.tag {
+			if image.url != update.url || image.tag != update.tag || image.platform != update.platform {
 				continue
 			}
 
@@ -46,6 +52,7 @@ func (c *Controller) getPatchMapByUpdates(updates []imageUpdateNotify) map[strin
 				containerName: image.containerName,
 				url:           update.url,
 				tag:           update.tag,
+				platform:      update.platform,
 				imageString:   update.imageString,
 			})
 
@@ -55,12 +62,21 @@ func (c *Controller) getPatchMapByUpdates(updates []imageUpdateNotify) map[strin
 	return patchMap
 }
 
-func (c *Controller) applyPatchList(key string, patchList []patch) error {
+func (c *Controller) applyPatchList(key string, patchList []patch) (err error) {
 
 	Containers := make([]util.Container, 0)
 	InitContainers := make([]util.Container, 0)
+	changes := make([]string, 0) // event message
+	rolloutContainers := make([]rolloutContainer, 0)
+	changedPatches := make([]patch, 0) // 보류할 patch
 	namespace, name := util.GetNamespaceNameByKey(key)
 
+	defer func() {
+		if err != nil {
+			metrics.AddPatch(c.resource, namespace, metrics.PatchFailed)
+		}
+	}()
+
 	if namespace == "" || name == "" {
 		return fmt.Errorf("[%s] OnUpdateImageString patch invalid key=%s", c.resource, key)
 	}
@@ -70,6 +86,11 @@ func (c *Controller) applyPatchList(key string, patchList []patch) error {
 		return fmt.Errorf("[%s] OnUpdateImageString patch error key=%s err=%s", c.resource, key, err)
 	}
 
+	currentAnnotations, _ := c.getAnnotations(obj)
+	annotations := make(map[string]string) // container별 history, bad-image annotation
+	minAge := c.getMinAge(obj, currentAnnotations)
+	soakingPatches := make([]patch, 0) // min-age가 지나지 않은 patch
+
 	for _, patch := range patchList {
 		c.logger.Infof("[%s] OnUpdateImageString patch %+v", c.resource, patch)
 
@@ -86,11 +107,30 @@ func (c *Controller) applyPatchList(key string, patchList []patch) error {
 				currentContainer = find // initContainer에서 찾음
 				isInitContainer = true
 			} else { // 컨테이너 이름을 찾지 못함
+				c.recordEventf(obj, v1.EventTypeWarning, EventReasonContainerNotFound, "container %s annotated with %s:%s does not exist", patch.containerName, patch.url, patch.tag)
 				return fmt.Errorf("[%s] OnUpdateImageString patch error key=%s, containerName=%s, err=%s", c.resource, key, patch.containerName, err)
 			}
 
+			if reason := currentAnnotations[c.watchKey+util.DisabledAnnotation+patch.containerName]; reason != "" { // rollback 등으로 추적이 중지된 container
+				c.logger.Infof("[%s] OnUpdateImageString patch disabled key=%s, containerName=%s, reason=%s", c.resource, key, patch.containerName, reason)
+				continue
+			}
+
+			badImageKey := c.watchKey + util.BadImageAnnotation + patch.containerName
+			if badImage := currentAnnotations[badImageKey]; badImage == patch.imageString { // rollout에 실패한 image. tag가 바뀔 때까지 patch 하지 않는다.
+				c.logger.Infof("[%s] OnUpdateImageString patch skip bad image key=%s, containerName=%s, imageString=%s", c.resource, key, patch.containerName, patch.imageString)
+				continue
+			} else if badImage != "" { // tag moved
+				annotations[badImageKey] = "" // patch에서 삭제
+			}
+
 			// 이미지 변경 체크
 			if currentContainer.Image != patch.imageString {
+				if c.getImageAge(patch) < minAge {
+					soakingPatches = append(soakingPatches, patch)
+					continue
+				}
+
 				container := util.Container{
 					Name:  patch.containerName,
 					Image: patch.imageString,
@@ -100,26 +140,77 @@ func (c *Controller) applyPatchList(key string, patchList []patch) error {
 				} else {
 					Containers = append(Containers, container)
 				}
+				historyKey := c.watchKey + util.HistoryAnnotation + patch.containerName
+				annotations[historyKey] = util.AppendHistory(currentAnnotations[historyKey], currentContainer.Image, time.Now())
+				changedPatches = append(changedPatches, patch)
+				rolloutContainers = append(rolloutContainers, rolloutContainer{
+					name:            patch.containerName,
+					isInitContainer: isInitContainer,
+					previousImage:   currentContainer.Image,
+					imageString:     patch.imageString,
+				})
+				changes = append(changes, fmt.Sprintf("container=%s, old=%s, new=%s, tag=%s:%s", patch.containerName, currentContainer.Image, patch.imageString, patch.url, patch.tag))
 			}
 		}
 	}
 
+	if len(soakingPatches) > 0 { // min-age가 지난 후 적용
+		c.holdPatches(obj, key, soakingPatches, fmt.Sprintf("%s %s", MinAgeSetting, minAge))
+	}
+	readyPatches := excludePatches(patchList, soakingPatches)
+
 	if len(Containers) == 0 && len(InitContainers) == 0 { // 변경된 이미지가 없는 경우 무시
-		c.logger.Infof("[%s] OnUpdateImageString patch containers not changed %+v", c.resource, patchList)
+		c.removePendingPatches(key, readyPatches)
+		if len(soakingPatches) == 0 {
+			c.logger.Infof("[%s] OnUpdateImageString patch containers not changed %+v", c.resource, patchList)
+			metrics.AddPatch(c.resource, namespace, metrics.PatchSkipped)
+		}
 		return nil
 	}
 
-	patchString, err := util.GetImageStrategicPatchJson(obj, Containers, InitContainers)
+	if reason := c.getHoldReason(obj, key); reason != "" { // paused, frozen-until
+		c.holdPatches(obj, key, changedPatches, reason)
+		return nil
+	}
+
+	patchString, err := util.GetImageStrategicPatchJson(obj, Containers, InitContainers, annotations)
 
 	if err != nil {
+		c.recordEventf(obj, v1.EventTypeWarning, EventReasonImageUpdateFailed, "failed to update images: %s, err=%s", strings.Join(changes, "; "), err)
 		return fmt.Errorf("[%s] OnUpdateImageString patch marshal error %+v, err=%s", c.resource, patchList, err)
 	}
 
-	if err := c.applyStrategicMergePatch(namespace, name, patchString); err != nil {
-		return fmt.Errorf("[%s] OnUpdateImageString patch apply error namespace=%s, name=%s, patchString=%s, err=%s", c.resource, namespace, name, patchString, err)
+	dryRun := c.isDryRun(obj, key, currentAnnotations)
+
+	if err := c.applyStrategicMergePatch(namespace, name, patchString, dryRun); err != nil {
+		c.recordEventf(obj, v1.EventTypeWarning, EventReasonImageUpdateFailed, "failed to update images: %s, dryRun=%v, err=%s", strings.Join(changes, "; "), dryRun, err)
+		return fmt.Errorf("[%s] OnUpdateImageString patch apply error namespace=%s, name=%s, dryRun=%v, patchString=%s, err=%s", c.resource, namespace, name, dryRun, patchString, err)
+	}
+	c.removePendingPatches(key, readyPatches) // 적용에 실패한 patch는 pending에 남겨 다시 시도한다.
+
+	if dryRun { // server-side dry-run으로 검증만 하고 적용하지 않음
+		c.logger.Warningf("[%s] OnUpdateImageString patch dry-run namespace=%s, name=%s, would update images: %s, patchString=%s", c.resource, namespace, name, strings.Join(changes, "; "), patchString)
+		c.recordEventf(obj, v1.EventTypeNormal, EventReasonImageUpdateDryRun, "would update images: %s", strings.Join(changes, "; "))
+		metrics.AddPatch(c.resource, namespace, metrics.PatchDryRun)
+		return nil
 	}
 
 	c.logger.Warningf("[%s] OnUpdateImageString patch apply success namespace=%s, name=%s, patchString=%s", c.resource, namespace, name, patchString)
+	c.recordEventf(obj, v1.EventTypeNormal, EventReasonImageUpdated, "updated images: %s", strings.Join(changes, "; "))
+	metrics.AddPatch(c.resource, namespace, metrics.PatchApplied)
+
+	if c.annotationSource != nil {
+		for _, patch := range changedPatches {
+			c.annotationSource.OnImagePatched(c.resource, obj, patch.containerName, patch.imageString)
+		}
+	}
+
+	if timeout := c.getRolloutDeadline(obj, key, currentAnnotations); timeout > 0 {
+		if _, supported := util.IsRolloutComplete(obj); supported {
+			c.watchRollout(key, rolloutContainers, timeout)
+		}
+	}
+
 	return nil
 
 }
@@ -130,6 +221,7 @@ func (c *Controller) OnUpdateImageString(url, tag, platformString, imageString s
 	notify := imageUpdateNotify{
 		url:         url,
 		tag:         tag,
+		platform:    platformString,
 		imageString: imageString,
 	}
 
@@ -137,6 +229,10 @@ func (c *Controller) OnUpdateImageString(url, tag, platformString, imageString s
 	c.imageUpdateNotifyList = append(c.imageUpdateNotifyList, notify)
 	c.imageUpdateNotifyListMutex.Unlock()
 
+	if c.annotationSource != nil {
+		c.annotationSource.OnImageResolved(url, tag, platformString, imageString)
+	}
+
 }
 
 // patchUpdateNotifyList 일정 시간마다 ImageUpdateNotifyList에 쌓인 업데이트 정보를 Kubernetes에 Apply하는 트리거
@@ -147,16 +243,28 @@ func (c *Controller) patchUpdateNotifyList() {
 	c.imageUpdateNotifyList = make([]imageUpdateNotify, 0) // list 비움
 	c.imageUpdateNotifyListMutex.Unlock()
 
-	if len(updates) == 0 {
-		return
-	}
-
 	patchMap := c.getPatchMapByUpdates(updates)
+	c.mergeReleasedPendingPatches(patchMap) // 보류가 해제된 patch
 
 	for key, patchList := range patchMap {
 		if err := c.applyPatchList(key, patchList); err != nil {
-			c.logger.Errorf(err.Error()) // just logging
+			c.logger.Errorf(err.Error())
+			c.retryPatches(patchList)
+			c.delayPendingPatches(key)
 		}
 	}
 
 }
+
+// retryPatches 적용에 실패한 patch의 image를 다음 check에서 다시 notify 받도록 imageNotifier에 요청한다.
+func (c *Controller) retryPatches(patchList []patch) {
+	retried := make(map[imageKey]bool)
+	for _, patch := range patchList {
+		image := imageKey{url: patch.url, tag: patch.tag, platform: patch.platform}
+		if retried[image] {
+			continue
+		}
+		retried[image] = true
+		c.imageNotifier.RetryImage(c, image.url, image.tag, image.platform)
+	}
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/interfaces"
+	"github.com/pubg/kube-image-deployer/logger"
+	"github.com/pubg/kube-image-deployer/util"
+	appV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// testImageNotifier RetryImage 요청을 기록한다.
+type testImageNotifier struct {
+	retried []string
+}
+
+func (n *testImageNotifier) RegistImage(c interfaces.IController, url, tag, platformString string) {}
+
+func (n *testImageNotifier) UnregistImage(c interfaces.IController, url, tag, platformString string) {
+}
+
+func (n *testImageNotifier) RetryImage(c interfaces.IController, url, tag, platformString string) {
+	n.retried = append(n.retried, url+":"+tag)
+}
+
+// newTestController busybox@sha256:1 이미지의 app container를 가진 default/test deployment가 등록된 controller를 생성한다.
+func newTestController(t *testing.T, applyStrategicMergePatch ApplyStrategicMergePatch, annotations map[string]string) (*Controller, *record.FakeRecorder) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&appV1.Deployment{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "default", Name: "test", Annotations: annotations},
+		Spec: appV1.DeploymentSpec{Template: coreV1.PodTemplateSpec{Spec: coreV1.PodSpec{
+			Containers: []coreV1.Container{{Name: "app", Image: "busybox@sha256:1"}},
+		}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	c := NewController(ControllerOpt{
+		Resource:                 "deployments",
+		ObjType:                  &appV1.Deployment{},
+		Indexer:                  indexer,
+		ImageNotifier:            &testImageNotifier{},
+		ApplyStrategicMergePatch: applyStrategicMergePatch,
+		ControllerWatchKey:       "kube-image-deployer",
+		Logger:                   logger.NewLogger(),
+		Recorder:                 recorder,
+	})
+	return c, recorder
+}
+
+func expectEvent(t *testing.T, recorder *record.FakeRecorder, prefix string) {
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, prefix) {
+			t.Fatalf("Expected: %s, Got: %s", prefix, event)
+		}
+	default:
+		t.Fatalf("Expected: %s, Got: no event", prefix)
+	}
+}
+
+func TestApplyPatchListEvent(t *testing.T) {
+	c, recorder := newTestController(t, func(namespace, name string, data []byte, dryRun bool) error { return nil }, nil)
+
+	err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: "busybox", tag: "1.34.*", imageString: "busybox@sha256:2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, recorder, "Normal ImageUpdated updated images: container=app, old=busybox@sha256:1, new=busybox@sha256:2, tag=busybox:1.34.*")
+
+	// 이미지가 같으면 patch, event 모두 없음
+	err = c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: "busybox", tag: "1.34.*", imageString: "busybox@sha256:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Fatalf("Expected: no event, Got: %s", <-recorder.Events)
+	}
+}
+
+func TestApplyPatchListWarningEvent(t *testing.T) {
+	c, recorder := newTestController(t, func(namespace, name string, data []byte, dryRun bool) error { return errors.New("forbidden") }, nil)
+
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: "busybox", tag: "latest", imageString: "busybox@sha256:2"}}); err == nil {
+		t.Fatal("Expected: patch error")
+	}
+	expectEvent(t, recorder, "Warning ImageUpdateFailed")
+
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "sidecar", url: "busybox", tag: "latest", imageString: "busybox@sha256:2"}}); err == nil {
+		t.Fatal("Expected: container not found error")
+	}
+	expectEvent(t, recorder, "Warning ContainerNotFound")
+}
+
+// patch에 이전 image가 history annotation으로 추가되어야 한다.
+func TestApplyPatchListHistory(t *testing.T) {
+	var data []byte
+	c, _ := newTestController(t, func(namespace, name string, d []byte, dryRun bool) error {
+		data = d
+		return nil
+	}, map[string]string{
+		"kube-image-deployer.history/app": util.AppendHistory("", "busybox@sha256:0", time.Now()),
+	})
+
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: "busybox", tag: "latest", imageString: "busybox@sha256:2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := util.ImageStrategicPatch{}
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := util.ParseHistory(p.Metadata.Annotations["kube-image-deployer.history/app"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 2 || history[0].Image != "busybox@sha256:1" || history[1].Image != "busybox@sha256:0" {
+		t.Fatalf("Expected: [busybox@sha256:1 busybox@sha256:0], Got: %+v", history)
+	}
+}
+
+// disabled annotation이 있는 container는 patch 하지 않아야 한다.
+func TestApplyPatchListDisabled(t *testing.T) {
+	patched := false
+	c, recorder := newTestController(t, func(namespace, name string, d []byte, dryRun bool) error {
+		patched = true
+		return nil
+	}, map[string]string{
+		"kube-image-deployer.disabled/app": "rollback",
+	})
+
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: "busybox", tag: "latest", imageString: "busybox@sha256:2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if patched || len(recorder.Events) != 0 {
+		t.Fatalf("Expected: disabled container not patched")
+	}
+}
+
+// dry-run이면 patch를 dry-run으로 전송하고, rollout을 감시하지 않아야 한다.
+func TestApplyPatchListDryRun(t *testing.T) {
+	dryRunPatched := false
+	c, recorder := newTestController(t, func(namespace, name string, d []byte, dryRun bool) error {
+		dryRunPatched = dryRun
+		return nil
+	}, map[string]string{
+		"kube-image-deployer.settings/dry-run":          "true",
+		"kube-image-deployer.settings/rollout-deadline": "10m",
+	})
+
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: "busybox", tag: "latest", imageString: "busybox@sha256:2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !dryRunPatched {
+		t.Fatalf("Expected: dry-run patch")
+	}
+	expectEvent(t, recorder, "Normal ImageUpdateDryRun would update images: container=app, old=busybox@sha256:1, new=busybox@sha256:2")
+
+	if len(c.rollouts) != 0 {
+		t.Fatalf("Expected: dry-run rollout not watched")
+	}
+}
+
+// patch에 실패하면 imageNotifier에 다시 notify를 요청하고, 다시 notify 받은 patch를 적용해야 한다.
+func TestPatchUpdateNotifyListRetry(t *testing.T) {
+	patched := make([]string, 0)
+	c, recorder := newTestController(t, func(namespace, name string, data []byte, dryRun bool) error {
+		patched = append(patched, string(data))
+		if len(patched) == 1 {
+			return errors.New("the server is currently unable to handle the request")
+		}
+		return nil
+	}, map[string]string{"kube-image-deployer/app": "busybox"})
+	c.syncedImages[Image{key: "default/test", containerName: "app", url: "busybox", tag: "latest"}] = true
+
+	c.OnUpdateImageString("busybox", "latest", "", "busybox@sha256:2")
+	c.patchUpdateNotifyList()
+
+	notifier := c.imageNotifier.(*testImageNotifier)
+	if len(notifier.retried) != 1 || notifier.retried[0] != "busybox:latest" {
+		t.Fatalf("Expected: retry busybox:latest, Got: %v", notifier.retried)
+	}
+	expectEvent(t, recorder, "Warning ImageUpdateFailed")
+
+	c.OnUpdateImageString("busybox", "latest", "", "busybox@sha256:2") // 다음 check에서 다시 notify
+	c.patchUpdateNotifyList()
+
+	if len(patched) != 2 || len(notifier.retried) != 1 {
+		t.Fatalf("Expected: second patch sent, Got: %v, retried=%v", patched, notifier.retried)
+	}
+	expectEvent(t, recorder, "Normal ImageUpdated updated images: container=app, old=busybox@sha256:1, new=busybox@sha256:2")
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/metrics"
+	v1 "k8s.io/api/core/v1"
+)
+
+// pendingRetryInterval 보류가 해제된 patch의 적용에 실패한 경우 다시 시도하기까지 기다리는 시간
+const pendingRetryInterval = 10 * time.Second
+
+// holdPatches paused, frozen-until 등으로 보류된 patch를 pending에 저장한다.
+// container별로 가장 최신 patch만 유지하며, 보류가 해제되면 patchUpdateNotifyList에서 적용한다.
+func (c *Controller) holdPatches(obj interface{}, key string, patchList []patch, reason string) {
+	c.pendingPatchesMutex.Lock()
+	defer c.pendingPatchesMutex.Unlock()
+
+	pending, ok := c.pendingPatches[key]
+	if !ok {
+		pending = make(map[string]patch)
+		c.pendingPatches[key] = pending
+	}
+
+	changes := make([]string, 0)
+	for _, patch := range patchList {
+		if prev, ok := pending[patch.containerName]; ok && prev == patch {
+			continue
+		}
+		pending[patch.containerName] = patch
+		changes = append(changes, fmt.Sprintf("container=%s, new=%s, tag=%s:%s", patch.containerName, patch.imageString, patch.url, patch.tag))
+	}
+
+	c.setPendingPatchesMetric()
+
+	if len(changes) > 0 { // 새로 보류된 patch만 알림
+		c.logger.Infof("[%s] OnUpdateImageString patch held key=%s, reason=%s, %s", c.resource, key, reason, strings.Join(changes, "; "))
+		c.recordEventf(obj, v1.EventTypeNormal, EventReasonImageUpdatePending, "update held (%s): %s", reason, strings.Join(changes, "; "))
+	}
+}
+
+// removePendingPatches 적용을 시도하는 patch를 pending에서 제거한다.
+func (c *Controller) removePendingPatches(key string, patchList []patch) {
+	c.pendingPatchesMutex.Lock()
+	defer c.pendingPatchesMutex.Unlock()
+
+	pending, ok := c.pendingPatches[key]
+	if !ok {
+		return
+	}
+
+	for _, patch := range patchList {
+		delete(pending, patch.containerName)
+	}
+	if len(pending) == 0 {
+		delete(c.pendingPatches, key)
+		delete(c.pendingRetryAt, key)
+	}
+
+	c.setPendingPatchesMetric()
+}
+
+// delayPendingPatches 적용에 실패한 workload의 pending patch를 pendingRetryInterval 후에 다시 시도한다.
+func (c *Controller) delayPendingPatches(key string) {
+	c.pendingPatchesMutex.Lock()
+	defer c.pendingPatchesMutex.Unlock()
+
+	if _, ok := c.pendingPatches[key]; ok {
+		c.pendingRetryAt[key] = time.Now().Add(pendingRetryInterval)
+	}
+}
+
+// mergeReleasedPendingPatches 보류가 해제된 workload의 pending patch를 patchMap에 추가한다.
+// 새로 들어온 patch가 있는 container는 새 patch를 사용한다. 삭제되었거나 추적하지 않는 container의 patch는 버린다.
+func (c *Controller) mergeReleasedPendingPatches(patchMap map[string][]patch) {
+	c.pendingPatchesMutex.Lock()
+	defer c.pendingPatchesMutex.Unlock()
+
+	for key, pending := range c.pendingPatches {
+		obj, exists, err := c.indexer.GetByKey(key)
+		if err != nil || !exists {
+			delete(c.pendingPatches, key)
+			delete(c.pendingRetryAt, key)
+			continue
+		}
+
+		for containerName, patch := range pending {
+			if !c.isSyncedImage(Image{key: key, containerName: containerName, url: patch.url, tag: patch.tag, platform: patch.platform}) {
+				delete(pending, containerName)
+			}
+		}
+		if len(pending) == 0 {
+			delete(c.pendingPatches, key)
+			delete(c.pendingRetryAt, key)
+			continue
+		}
+
+		if time.Now().Before(c.pendingRetryAt[key]) { // 적용에 실패한 patch
+			continue
+		}
+
+		if reason := c.getHoldReason(obj, key); reason != "" {
+			continue
+		}
+
+		annotations, _ := c.getAnnotations(obj)
+		minAge := c.getMinAge(obj, annotations)
+
+		for containerName, patch := range pending {
+			if c.getImageAge(patch) < minAge { // 아직 min-age가 지나지 않음
+				continue
+			}
+			if !containsContainer(patchMap[key], containerName) {
+				patchMap[key] = append(patchMap[key], patch)
+			}
+		}
+	}
+
+	c.setPendingPatchesMetric()
+}
+
+// setPendingPatchesMetric must be called with pendingPatchesMutex held
+func (c *Controller) setPendingPatchesMetric() {
+	count := 0
+	for _, pending := range c.pendingPatches {
+		count += len(pending)
+	}
+	metrics.SetPendingUpdates(c.resource, count)
+}
+
+func (c *Controller) isSyncedImage(image Image) bool {
+	c.syncedImagesMutex.RLock()
+	defer c.syncedImagesMutex.RUnlock()
+	return c.syncedImages[image]
+}
+
+func containsContainer(patchList []patch, containerName string) bool {
+	for _, patch := range patchList {
+		if patch.containerName == containerName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	appV1 "k8s.io/api/apps/v1"
+)
+
+// setTestDeploymentAnnotations informer cache의 default/test deployment annotation을 변경한다.
+func setTestDeploymentAnnotations(t *testing.T, c *Controller, annotations map[string]string) {
+	obj, _, _ := c.indexer.GetByKey("default/test")
+	deployment := obj.(*appV1.Deployment).DeepCopy()
+	deployment.Annotations = annotations
+	if err := c.indexer.Update(deployment); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// paused workload는 patch를 보류하고, 해제되면 가장 최신 patch를 적용해야 한다.
+func TestPendingPatchesPaused(t *testing.T) {
+	patched := make([]string, 0)
+	c, recorder := newTestController(t, func(namespace, name string, data []byte, dryRun bool) error {
+		patched = append(patched, string(data))
+		return nil
+	}, map[string]string{
+		"kube-image-deployer/app":             "busybox",
+		"kube-image-deployer.settings/paused": "true",
+	})
+	c.syncedImages[Image{key: "default/test", containerName: "app", url: "busybox", tag: "latest"}] = true
+
+	c.OnUpdateImageString("busybox", "latest", "", "busybox@sha256:2")
+	c.patchUpdateNotifyList()
+	c.OnUpdateImageString("busybox", "latest", "", "busybox@sha256:3")
+	c.patchUpdateNotifyList()
+
+	if len(patched) != 0 {
+		t.Fatalf("Expected: no patch while paused, Got: %v", patched)
+	}
+	expectEvent(t, recorder, "Normal ImageUpdatePending update held (paused): container=app, new=busybox@sha256:2")
+	expectEvent(t, recorder, "Normal ImageUpdatePending update held (paused): container=app, new=busybox@sha256:3")
+
+	if len(c.pendingPatches["default/test"]) != 1 {
+		t.Fatalf("Expected: 1 pending patch, Got: %v", c.pendingPatches)
+	}
+
+	setTestDeploymentAnnotations(t, c, map[string]string{
+		"kube-image-deployer/app":                   "busybox",
+		"kube-image-deployer.settings/frozen-until": time.Now().Add(-time.Minute).Format(time.RFC3339), // 이미 지남
+	})
+	c.patchUpdateNotifyList()
+
+	if len(patched) != 1 || len(c.pendingPatches) != 0 {
+		t.Fatalf("Expected: latest pending patch applied, Got: %v, pending=%v", patched, c.pendingPatches)
+	}
+	expectEvent(t, recorder, "Normal ImageUpdated updated images: container=app, old=busybox@sha256:1, new=busybox@sha256:3")
+}
+
+func TestGetHoldReasonFrozenUntil(t *testing.T) {
+	frozenUntil := time.Now().Add(time.Hour).Format(time.RFC3339)
+	c, _ := newTestController(t, nil, map[string]string{
+		"kube-image-deployer.settings/frozen-until": frozenUntil,
+	})
+
+	obj, _, _ := c.indexer.GetByKey("default/test")
+	if reason := c.getHoldReason(obj, "default/test"); reason != "frozen-until "+frozenUntil {
+		t.Fatalf("Expected: frozen-until %s, Got: %s", frozenUntil, reason)
+	}
+}
+
+func TestGetHoldReasonWindow(t *testing.T) {
+	c, _ := newTestController(t, nil, map[string]string{
+		"kube-image-deployer.settings/window": "* 00:00-24:00 Asia/Seoul",
+	})
+
+	obj, _, _ := c.indexer.GetByKey("default/test")
+	if reason := c.getHoldReason(obj, "default/test"); reason != "" {
+		t.Fatalf("Expected: inside window, Got: %s", reason)
+	}
+
+	now := time.Now().UTC()
+	outside := now.Add(time.Hour).Format("15:04") + "-" + now.Add(2*time.Hour).Format("15:04")
+	setTestDeploymentAnnotations(t, c, map[string]string{
+		"kube-image-deployer.settings/window": "* " + outside,
+	})
+
+	obj, _, _ = c.indexer.GetByKey("default/test")
+	if reason := c.getHoldReason(obj, "default/test"); reason != "outside window * "+outside {
+		t.Fatalf("Expected: outside window * %s, Got: %s", outside, reason)
+	}
+}
+
+// min-age가 지나지 않은 image는 보류하고, 지나면 적용해야 한다.
+func TestPendingPatchesMinAge(t *testing.T) {
+	patched := 0
+	c, recorder := newTestController(t, func(namespace, name string, data []byte, dryRun bool) error {
+		patched++
+		return nil
+	}, map[string]string{
+		"kube-image-deployer/app":              "busybox",
+		"kube-image-deployer.settings/min-age": "30m",
+	})
+	c.syncedImages[Image{key: "default/test", containerName: "app", url: "busybox", tag: "latest"}] = true
+
+	c.OnUpdateImageString("busybox", "latest", "", "busybox@sha256:2")
+	c.patchUpdateNotifyList()
+
+	if patched != 0 {
+		t.Fatalf("Expected: no patch before min-age")
+	}
+	expectEvent(t, recorder, "Normal ImageUpdatePending update held (min-age 30m0s): container=app, new=busybox@sha256:2")
+
+	// 30분 전부터 같은 image였던 것으로 변경
+	image := imageKey{url: "busybox", tag: "latest"}
+	c.seenImages[image] = seenImage{imageString: "busybox@sha256:2", since: time.Now().Add(-31 * time.Minute)}
+	c.patchUpdateNotifyList()
+
+	if patched != 1 || len(c.pendingPatches) != 0 {
+		t.Fatalf("Expected: patch after min-age, Got: %d, pending=%v", patched, c.pendingPatches)
+	}
+	expectEvent(t, recorder, "Normal ImageUpdated updated images: container=app, old=busybox@sha256:1, new=busybox@sha256:2")
+}
+
+// 보류가 해제된 patch의 적용에 실패하면 pending에 남겨두고, pendingRetryInterval 후에 다시 시도해야 한다.
+func TestPendingPatchesApplyFailed(t *testing.T) {
+	failed := true
+	patched := 0
+	c, recorder := newTestController(t, func(namespace, name string, data []byte, dryRun bool) error {
+		if failed {
+			return errors.New("conflict")
+		}
+		patched++
+		return nil
+	}, map[string]string{
+		"kube-image-deployer/app":             "busybox",
+		"kube-image-deployer.settings/paused": "true",
+	})
+	c.syncedImages[Image{key: "default/test", containerName: "app", url: "busybox", tag: "latest"}] = true
+
+	c.OnUpdateImageString("busybox", "latest", "", "busybox@sha256:2")
+	c.patchUpdateNotifyList()
+	expectEvent(t, recorder, "Normal ImageUpdatePending update held (paused)")
+
+	setTestDeploymentAnnotations(t, c, map[string]string{"kube-image-deployer/app": "busybox"})
+	c.patchUpdateNotifyList()
+	expectEvent(t, recorder, "Warning ImageUpdateFailed")
+
+	if len(c.pendingPatches["default/test"]) != 1 {
+		t.Fatalf("Expected: failed patch kept pending, Got: %v", c.pendingPatches)
+	}
+
+	failed = false
+	c.patchUpdateNotifyList() // pendingRetryInterval이 지나지 않음
+	if patched != 0 {
+		t.Fatalf("Expected: no retry before pendingRetryInterval")
+	}
+
+	c.pendingRetryAt["default/test"] = time.Now().Add(-time.Second)
+	c.patchUpdateNotifyList()
+
+	if patched != 1 || len(c.pendingPatches) != 0 || len(c.pendingRetryAt) != 0 {
+		t.Fatalf("Expected: pending patch applied on retry, Got: %d, pending=%v", patched, c.pendingPatches)
+	}
+	expectEvent(t, recorder, "Normal ImageUpdated updated images: container=app, old=busybox@sha256:1, new=busybox@sha256:2")
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/metrics"
+	"github.com/pubg/kube-image-deployer/util"
+	v1 "k8s.io/api/core/v1"
+)
+
+// imageKey url, tag, platform으로 구분되는 tracking 대상 image
+type imageKey struct {
+	url      string
+	tag      string
+	platform string
+}
+
+// rolloutContainer patch로 image가 변경된 container
+type rolloutContainer struct {
+	name            string
+	isInitContainer bool
+	previousImage   string // rollback할 image string
+	imageString     string // patch한 image string
+}
+
+// rollout patch 후 완료를 기다리는 workload
+type rollout struct {
+	key        string
+	timeout    time.Duration
+	deadline   time.Time
+	containers map[string]rolloutContainer
+}
+
+// watchRollout patch한 workload의 rollout을 deadline까지 감시한다.
+// 이전 rollout이 완료되기 전에 다시 patch 된 경우 처음 patch 이전의 image로 rollback 한다.
+func (c *Controller) watchRollout(key string, containers []rolloutContainer, timeout time.Duration) {
+	c.rolloutsMutex.Lock()
+	defer c.rolloutsMutex.Unlock()
+
+	r := &rollout{
+		key:        key,
+		timeout:    timeout,
+		deadline:   time.Now().Add(timeout),
+		containers: make(map[string]rolloutContainer),
+	}
+
+	if prev, ok := c.rollouts[key]; ok {
+		r.containers = prev.containers
+	}
+
+	for _, container := range containers {
+		if prev, ok := r.containers[container.name]; ok {
+			container.previousImage = prev.previousImage
+		}
+		r.containers[container.name] = container
+	}
+
+	c.rollouts[key] = r
+}
+
+// checkRollouts 감시중인 rollout의 완료 여부를 확인하고, deadline이 지난 rollout은 이전 image로 rollback 한다.
+func (c *Controller) checkRollouts() {
+
+	c.rolloutsMutex.Lock()
+	rollouts := make([]*rollout, 0, len(c.rollouts))
+	for _, r := range c.rollouts {
+		rollouts = append(rollouts, r)
+	}
+	c.rolloutsMutex.Unlock()
+
+	for _, r := range rollouts {
+		obj, exists, err := c.indexer.GetByKey(r.key)
+		if err != nil || !exists { // 삭제된 리소스인 경우 무시
+			c.finishRollout(r)
+			continue
+		}
+
+		applied, changed := c.getRolloutSpecState(obj, r)
+
+		if changed { // 다른 image로 변경됨(수동 변경, 다음 patch 등)
+			c.logger.Infof("[%s] checkRollouts image changed, stop watching key=%s\n", c.resource, r.key)
+			c.finishRollout(r)
+			continue
+		}
+
+		complete, supported := util.IsRolloutComplete(obj)
+		if !supported { // OnDelete, paused 등으로 변경되어 완료 여부를 알 수 없음
+			c.logger.Infof("[%s] checkRollouts rollout status not supported, stop watching key=%s\n", c.resource, r.key)
+			c.finishRollout(r)
+			continue
+		}
+
+		if applied {
+			if complete {
+				c.logger.Infof("[%s] checkRollouts rollout complete key=%s\n", c.resource, r.key)
+				c.finishRollout(r)
+				continue
+			}
+		}
+
+		if time.Now().Before(r.deadline) {
+			continue
+		}
+
+		if c.finishRollout(r) {
+			if err := c.rollback(obj, r); err != nil {
+				c.logger.Errorf(err.Error())
+			}
+		}
+	}
+}
+
+// finishRollout 감시를 종료한다. 그 사이 다시 patch 되어 새 rollout으로 교체된 경우 false를 반환한다.
+func (c *Controller) finishRollout(r *rollout) bool {
+	c.rolloutsMutex.Lock()
+	defer c.rolloutsMutex.Unlock()
+
+	if c.rollouts[r.key] != r {
+		return false
+	}
+	delete(c.rollouts, r.key)
+	return true
+}
+
+// getRolloutSpecState informer cache의 workload spec에 patch가 반영되었는지 확인한다.
+// changed는 patch 이전, 이후가 아닌 다른 image로 변경된 container가 있는 경우 true
+func (c *Controller) getRolloutSpecState(obj interface{}, r *rollout) (applied bool, changed bool) {
+	applied = true
+
+	for _, container := range r.containers {
+		current, err := c.getContainerImage(obj, container.name, container.isInitContainer)
+		if err != nil {
+			return false, true
+		}
+
+		switch current {
+		case container.imageString:
+		case container.previousImage: // cache에 아직 반영되지 않음
+			applied = false
+		default:
+			return false, true
+		}
+	}
+
+	return applied, false
+}
+
+func (c *Controller) getContainerImage(obj interface{}, name string, isInitContainer bool) (string, error) {
+	var container v1.Container
+	var err error
+
+	if isInitContainer {
+		container, err = util.GetInitContainerByName(obj, name)
+	} else {
+		container, err = util.GetContainerByName(obj, name)
+	}
+
+	return container.Image, err
+}
+
+// rollback rollout에 실패한 workload를 patch 이전 image로 되돌리고, 실패한 image string을 bad로 표시한다.
+func (c *Controller) rollback(obj interface{}, r *rollout) error {
+
+	namespace, name := util.GetNamespaceNameByKey(r.key)
+	currentAnnotations, _ := c.getAnnotations(obj)
+
+	Containers := make([]util.Container, 0)
+	InitContainers := make([]util.Container, 0)
+	annotations := make(map[string]string)
+	changes := make([]string, 0)
+
+	for _, container := range r.containers {
+		rollbackContainer := util.Container{Name: container.name, Image: container.previousImage}
+		if container.isInitContainer {
+			InitContainers = append(InitContainers, rollbackContainer)
+		} else {
+			Containers = append(Containers, rollbackContainer)
+		}
+
+		historyKey := c.watchKey + util.HistoryAnnotation + container.name
+		annotations[historyKey] = util.AppendHistory(currentAnnotations[historyKey], container.imageString, time.Now())
+		annotations[c.watchKey+util.BadImageAnnotation+container.name] = container.imageString
+		changes = append(changes, fmt.Sprintf("container=%s, failed=%s, rollback=%s", container.name, container.imageString, container.previousImage))
+	}
+
+	patchString, err := util.GetImageStrategicPatchJson(obj, Containers, InitContainers, annotations)
+	if err == nil {
+		err = c.applyStrategicMergePatch(namespace, name, patchString, false)
+	}
+
+	if err != nil {
+		c.recordEventf(obj, v1.EventTypeWarning, EventReasonRollbackFailed, "rollout did not complete within %s, failed to roll back: %s, err=%s", r.timeout, strings.Join(changes, "; "), err)
+		metrics.AddPatch(c.resource, namespace, metrics.PatchFailed)
+		return fmt.Errorf("[%s] rollback apply error namespace=%s, name=%s, patchString=%s, err=%s", c.resource, namespace, name, patchString, err)
+	}
+
+	c.recordEventf(obj, v1.EventTypeWarning, EventReasonRolloutFailed, "rollout did not complete within %s, rolled back: %s", r.timeout, strings.Join(changes, "; "))
+	c.logger.Warningf("[%s] rollback apply success namespace=%s, name=%s, timeout=%s, patchString=%s", c.resource, namespace, name, r.timeout, patchString)
+	metrics.AddPatch(c.resource, namespace, metrics.PatchRolledBack)
+	return nil
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	appV1 "k8s.io/api/apps/v1"
+)
+
+// setTestDeploymentImage informer cache의 default/test deployment app container image와 available replica를 변경한다.
+func setTestDeploymentImage(t *testing.T, c *Controller, image string, availableReplicas int32) {
+	obj, _, _ := c.indexer.GetByKey("default/test")
+	deployment := obj.(*appV1.Deployment).DeepCopy()
+	deployment.Spec.Template.Spec.Containers[0].Image = image
+	deployment.Status.Replicas = 1
+	deployment.Status.UpdatedReplicas = 1
+	deployment.Status.AvailableReplicas = availableReplicas
+	if err := c.indexer.Update(deployment); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deadline까지 rollout이 완료되지 않으면 이전 image로 rollback 하고, tag가 바뀔 때까지 같은 image로 patch 하지 않아야 한다.
+func TestRolloutDeadlineRollback(t *testing.T) {
+	patches := make([]string, 0)
+	c, recorder := newTestController(t, func(namespace, name string, data []byte, dryRun bool) error {
+		patches = append(patches, string(data))
+		return nil
+	}, map[string]string{
+		"kube-image-deployer.settings/rollout-deadline": "10ms",
+	})
+
+	update := imageUpdateNotify{url: "busybox", tag: "latest", imageString: "busybox@sha256:2"}
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: update.url, tag: update.tag, imageString: update.imageString}}); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, recorder, "Normal ImageUpdated")
+
+	setTestDeploymentImage(t, c, "busybox@sha256:2", 0) // crash loop
+	time.Sleep(20 * time.Millisecond)
+	c.checkRollouts()
+
+	if len(patches) != 2 || !strings.Contains(patches[1], `"image":"busybox@sha256:1"`) {
+		t.Fatalf("Expected: rollback to busybox@sha256:1, Got: %v", patches)
+	}
+	expectEvent(t, recorder, "Warning RolloutFailed")
+
+	if len(c.rollouts) != 0 {
+		t.Fatalf("Expected: rollout finished, Got: %d", len(c.rollouts))
+	}
+
+	badImageKey := "kube-image-deployer.bad-image/app"
+	if !strings.Contains(patches[1], `"`+badImageKey+`":"busybox@sha256:2"`) {
+		t.Fatalf("Expected: busybox@sha256:2 marked bad, Got: %s", patches[1])
+	}
+
+	// rollback patch가 반영된 workload. 재시작 후에도 annotation으로 bad image를 알 수 있다.
+	obj, _, _ := c.indexer.GetByKey("default/test")
+	deployment := obj.(*appV1.Deployment).DeepCopy()
+	deployment.Spec.Template.Spec.Containers[0].Image = "busybox@sha256:1"
+	deployment.Annotations[badImageKey] = "busybox@sha256:2"
+	if err := c.indexer.Update(deployment); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: update.url, tag: update.tag, imageString: update.imageString}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("Expected: bad image not patched, Got: %v", patches)
+	}
+
+	// tag moved
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: update.url, tag: update.tag, imageString: "busybox@sha256:3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 3 || !strings.Contains(patches[2], `"`+badImageKey+`":null`) || !strings.Contains(patches[2], `"image":"busybox@sha256:3"`) {
+		t.Fatalf("Expected: patched to busybox@sha256:3 and bad image cleared, Got: %v", patches)
+	}
+}
+
+func TestRolloutComplete(t *testing.T) {
+	patches := 0
+	c, _ := newTestController(t, func(namespace, name string, data []byte, dryRun bool) error {
+		patches++
+		return nil
+	}, map[string]string{
+		"kube-image-deployer.settings/rollout-deadline": "10ms",
+	})
+
+	if err := c.applyPatchList("default/test", []patch{{key: "default/test", containerName: "app", url: "busybox", tag: "latest", imageString: "busybox@sha256:2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.checkRollouts() // cache에 아직 반영되지 않음
+	if len(c.rollouts) != 1 {
+		t.Fatalf("Expected: rollout watched, Got: %d", len(c.rollouts))
+	}
+
+	setTestDeploymentImage(t, c, "busybox@sha256:2", 1)
+	c.checkRollouts()
+
+	if len(c.rollouts) != 0 || patches != 1 {
+		t.Fatalf("Expected: rollout complete without rollback, Got: rollouts=%d, patches=%d", len(c.rollouts), patches)
+	}
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/util"
+)
+
+// workload 단위 설정 annotation. <watchKey>.settings/<setting>=<value>
+// container 이름과 겹치지 않도록 <watchKey>/<containerName>과 다른 prefix를 사용한다.
+// 이전의 <watchKey>/<setting>도 같은 이름의 container가 없는 workload에서는 설정으로 사용한다.
+const (
+	SettingsAnnotation = ".settings/"
+
+	rolloutDeadlineSetting = "rollout-deadline" // <watchKey>.settings/rollout-deadline=<duration>. patch 후 rollout이 완료되어야 하는 시간. 0이면 감시하지 않는다.
+	dryRunSetting          = "dry-run"          // <watchKey>.settings/dry-run=<true|false>. patch를 server-side dry-run으로만 전송한다.
+	pausedSetting          = "paused"           // <watchKey>.settings/paused=<true|false>. image 추적은 계속하고 patch는 보류한다.
+	frozenUntilSetting     = "frozen-until"     // <watchKey>.settings/frozen-until=<RFC3339>. 해당 시간까지 patch를 보류한다.
+	WindowSetting          = "window"           // <watchKey>.settings/window=<days> <HH:MM>-<HH:MM> [<time zone>]. window 밖에서는 patch를 보류한다.
+	MinAgeSetting          = "min-age"          // <watchKey>.settings/min-age=<duration>. 새 image string이 이 시간 동안 유지되어야 patch 한다.
+
+	TemplateConfigMapSetting = "template-configmap" // <watchKey>.settings/template-configmap=<configMap>/<key>. Job의 configmap update strategy에서 patch 할 Job template
+)
+
+// workloadSettings 같은 이름의 container가 없으면 container가 아닌 설정인 <watchKey>/<setting> annotation 목록
+var workloadSettings = map[string]bool{
+	rolloutDeadlineSetting:   true,
+	dryRunSetting:            true,
+	pausedSetting:            true,
+	frozenUntilSetting:       true,
+	WindowSetting:            true,
+	MinAgeSetting:            true,
+	TemplateConfigMapSetting: true,
+}
+
+// GetSetting <watchKey>.settings/<setting> annotation 값을 반환한다.
+// 없으면 <watchKey>/<setting> annotation 값을 반환한다. 단, obj에 같은 이름의 container가 있으면 container annotation이므로 무시한다.
+func GetSetting(obj interface{}, annotations map[string]string, watchKey, setting string) (string, bool) {
+	if value, ok := annotations[watchKey+SettingsAnnotation+setting]; ok {
+		return value, true
+	}
+
+	if hasContainer(obj, setting) {
+		return "", false
+	}
+
+	value, ok := annotations[watchKey+"/"+setting]
+	return value, ok
+}
+
+func (c *Controller) getSetting(obj interface{}, annotations map[string]string, setting string) (string, bool) {
+	return GetSetting(obj, annotations, c.watchKey, setting)
+}
+
+// getRolloutDeadline <watchKey>.settings/rollout-deadline annotation 값을 반환한다. 없거나 잘못된 값이면 --rollout-deadline-sec을 사용한다.
+func (c *Controller) getRolloutDeadline(obj interface{}, key string, annotations map[string]string) time.Duration {
+	value, ok := c.getSetting(obj, annotations, rolloutDeadlineSetting)
+	if !ok {
+		return c.rolloutDeadline
+	}
+
+	deadline, err := time.ParseDuration(value)
+	if err != nil || deadline < 0 {
+		c.logger.Warningf("[%s] getRolloutDeadline invalid annotation key=%s, %s=%s, err=%v\n", c.resource, key, rolloutDeadlineSetting, value, err)
+		return c.rolloutDeadline
+	}
+
+	return deadline
+}
+
+// isDryRun <watchKey>.settings/dry-run annotation 값을 반환한다. 없거나 잘못된 값이면 --dry-run을 사용한다.
+func (c *Controller) isDryRun(obj interface{}, key string, annotations map[string]string) bool {
+	value, ok := c.getSetting(obj, annotations, dryRunSetting)
+	if !ok {
+		return c.dryRun
+	}
+
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		c.logger.Warningf("[%s] isDryRun invalid annotation key=%s, %s=%s, err=%v\n", c.resource, key, dryRunSetting, value, err)
+		return c.dryRun
+	}
+
+	return dryRun
+}
+
+// getHoldReason patch를 보류해야 하는 이유를 반환한다. 보류하지 않으면 ""
+// 잘못된 설정 값은 무시한다. (sync 시점에 validateWorkloadSettings에서 경고)
+func (c *Controller) getHoldReason(obj interface{}, key string) string {
+	annotations, _ := c.getAnnotations(obj)
+
+	if value, ok := c.getSetting(obj, annotations, pausedSetting); ok {
+		if paused, err := strconv.ParseBool(value); err == nil && paused {
+			return pausedSetting
+		}
+	}
+
+	if value, ok := c.getSetting(obj, annotations, frozenUntilSetting); ok {
+		if frozenUntil, err := time.Parse(time.RFC3339, value); err == nil && time.Now().Before(frozenUntil) {
+			return frozenUntilSetting + " " + value
+		}
+	}
+
+	if value, ok := c.getSetting(obj, annotations, WindowSetting); ok {
+		if window, err := util.ParseWindow(value); err == nil && !window.Contains(time.Now()) {
+			return "outside " + WindowSetting + " " + value
+		}
+	}
+
+	return ""
+}
+
+// getMinAge <watchKey>.settings/min-age annotation 값을 반환한다. 없거나 잘못된 값이면 0
+func (c *Controller) getMinAge(obj interface{}, annotations map[string]string) time.Duration {
+	value, _ := c.getSetting(obj, annotations, MinAgeSetting)
+	minAge, err := time.ParseDuration(value)
+	if err != nil {
+		return 0
+	}
+	return minAge
+}
+
+// validateWorkloadSettings 잘못된 workload 설정 annotation을 경고한다.
+func (c *Controller) validateWorkloadSettings(obj interface{}, key string, annotations map[string]string) {
+	if value, ok := c.getSetting(obj, annotations, pausedSetting); ok {
+		if _, err := strconv.ParseBool(value); err != nil {
+			c.logger.Warningf("[%s] validateWorkloadSettings invalid annotation key=%s, %s=%s, err=%v\n", c.resource, key, pausedSetting, value, err)
+		}
+	}
+
+	if value, ok := c.getSetting(obj, annotations, frozenUntilSetting); ok {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			c.logger.Warningf("[%s] validateWorkloadSettings invalid annotation key=%s, %s=%s, err=%v\n", c.resource, key, frozenUntilSetting, value, err)
+		}
+	}
+
+	if value, ok := c.getSetting(obj, annotations, MinAgeSetting); ok {
+		if _, err := time.ParseDuration(value); err != nil {
+			c.logger.Warningf("[%s] validateWorkloadSettings invalid annotation key=%s, %s=%s, err=%v\n", c.resource, key, MinAgeSetting, value, err)
+		}
+	}
+
+	if value, ok := c.getSetting(obj, annotations, WindowSetting); ok {
+		if _, err := util.ParseWindow(value); err != nil {
+			c.logger.Warningf("[%s] validateWorkloadSettings invalid annotation key=%s, %s=%s, err=%v\n", c.resource, key, WindowSetting, value, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"testing"
+
+	appV1 "k8s.io/api/apps/v1"
+)
+
+func TestGetSetting(t *testing.T) {
+	c, _ := newTestController(t, nil, nil)
+	obj, _, _ := c.indexer.GetByKey("default/test")
+
+	if value, ok := c.getSetting(obj, map[string]string{
+		"kube-image-deployer/rollout-deadline":          "5m",
+		"kube-image-deployer.settings/rollout-deadline": "10m",
+	}, rolloutDeadlineSetting); !ok || value != "10m" {
+		t.Fatalf("Expected: .settings/ annotation first, Got: %s, %v", value, ok)
+	}
+
+	if value, ok := c.getSetting(obj, map[string]string{"kube-image-deployer/rollout-deadline": "5m"}, rolloutDeadlineSetting); !ok || value != "5m" {
+		t.Fatalf("Expected: <watchKey>/<setting> annotation, Got: %s, %v", value, ok)
+	}
+
+	if value, ok := c.getSetting(obj, map[string]string{"kube-image-deployer/app": "busybox"}, "app"); ok {
+		t.Fatalf("Expected: container annotation is not a setting, Got: %s", value)
+	}
+}
+
+// 설정 이름과 같은 이름의 container도 추적해야 한다.
+func TestGetImagesFromCurrentWorkloadSettingName(t *testing.T) {
+	c, _ := newTestController(t, nil, nil)
+	obj, _, _ := c.indexer.GetByKey("default/test")
+	deployment := obj.(*appV1.Deployment).DeepCopy()
+	deployment.Spec.Template.Spec.Containers[0].Name = "window"
+	deployment.Annotations = map[string]string{
+		"kube-image-deployer/window": "busybox:latest",
+	}
+
+	images := c.getImagesFromCurrentWorkload(deployment, "default/test")
+	if len(images) != 1 || !images[Image{key: "default/test", containerName: "window", url: "busybox", tag: "latest"}] {
+		t.Fatalf("Expected: window container tracked, Got: %v", images)
+	}
+}
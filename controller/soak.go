@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"time"
+)
+
+// seenImage tag가 가리키는 image string과 처음 관찰된 시간
+type seenImage struct {
+	imageString string
+	since       time.Time
+}
+
+// observeImage tag가 가리키는 image string이 바뀌면 처음 관찰된 시간을 기록한다.
+func (c *Controller) observeImage(update imageUpdateNotify) {
+	c.seenImagesMutex.Lock()
+	defer c.seenImagesMutex.Unlock()
+
+	image := imageKey{url: update.url, tag: update.tag, platform: update.platform}
+	if seen, ok := c.seenImages[image]; ok && seen.imageString == update.imageString {
+		return
+	}
+
+	c.seenImages[image] = seenImage{imageString: update.imageString, since: time.Now()}
+}
+
+// getImageAge patch의 image string이 tag의 결과로 계속 유지된 시간을 반환한다. 관찰된 적이 없으면 0
+func (c *Controller) getImageAge(patch patch) time.Duration {
+	c.seenImagesMutex.Lock()
+	defer c.seenImagesMutex.Unlock()
+
+	seen, ok := c.seenImages[imageKey{url: patch.url, tag: patch.tag, platform: patch.platform}]
+	if !ok || seen.imageString != patch.imageString {
+		return 0
+	}
+
+	return time.Since(seen.since)
+}
+
+// excludePatches patchList에서 excludes의 container를 제외한다.
+func excludePatches(patchList []patch, excludes []patch) []patch {
+	result := make([]patch, 0, len(patchList))
+	for _, patch := range patchList {
+		if !containsContainer(excludes, patch.containerName) {
+			result = append(result, patch)
+		}
+	}
+	return result
+}
@@ -3,7 +3,9 @@ package controller
 import (
 	"strings"
 
+	"github.com/pubg/kube-image-deployer/metrics"
 	"github.com/pubg/kube-image-deployer/util"
+	v1 "k8s.io/api/core/v1"
 )
 
 type Image struct {
@@ -11,8 +13,14 @@ type Image struct {
 	containerName string
 	url           string
 	tag           string
+	platform      string
 }
 
+const (
+	platformAnnotation = ".platform/" // <watchKey>.platform/<containerName>=<os/arch|auto>
+	platformAuto       = "auto"       // nodeSelector, nodeAffinity의 kubernetes.io/arch에서 platform을 추출
+)
+
 func (c *Controller) syncKey(key string) error {
 
 	obj, exists, err := c.indexer.GetByKey(key)
@@ -49,13 +57,16 @@ func (c *Controller) syncKey(key string) error {
 func (c *Controller) getImagesFromCurrentWorkload(obj interface{}, key string) (images map[Image]bool) {
 
 	images = make(map[Image]bool)
-	annotations, err := util.GetAnnotations(obj)
+	disabled := 0
+	annotations, err := c.getAnnotations(obj)
 
 	if err != nil {
 		c.logger.Errorf("[%s] GetAnnotations error : %v", c.resource, err)
 		return
 	}
 
+	c.validateWorkloadSettings(obj, key, annotations)
+
 	for annotationKey, annotationValue := range annotations {
 
 		if !strings.HasPrefix(annotationKey, c.watchKey+"/") { // prefix check
@@ -71,20 +82,40 @@ func (c *Controller) getImagesFromCurrentWorkload(obj interface{}, key string) (
 
 		containerName := keys[1]
 
-		arr := strings.Split(annotationValue, ":")
-		if len(arr) == 2 {
-			image := Image{
-				key:           key,
-				containerName: containerName,
-				url:           arr[0],
-				tag:           arr[1],
-			}
-			images[image] = true
+		if workloadSettings[containerName] && !hasContainer(obj, containerName) { // container가 아닌 workload 설정
+			continue
+		}
+
+		url, tag, err := util.ParseImage(annotationValue)
+		if err != nil {
+			c.logger.Warningf("[%s] getImagesFromCurrentWorkload invalid annotation key=%s, annotation=%s: %s, err=%s\n", c.resource, key, annotationKey, annotationValue, err)
+			continue
+		}
+
+		if reason := annotations[c.watchKey+util.DisabledAnnotation+containerName]; reason != "" { // rollback 등으로 추적이 중지된 container
+			c.logger.Infof("[%s] getImagesFromCurrentWorkload container disabled key=%s, containerName=%s, reason=%s\n", c.resource, key, containerName, reason)
+			disabled++
+			continue
+		}
+
+		if !hasContainer(obj, containerName) { // annotation의 container가 workload에 없음
+			c.logger.Warningf("[%s] getImagesFromCurrentWorkload container not found key=%s, annotation=%s: %s\n", c.resource, key, annotationKey, annotationValue)
+			c.recordEventf(obj, v1.EventTypeWarning, EventReasonContainerNotFound, "container %s annotated with %s does not exist", containerName, annotationValue)
+			continue
+		}
+
+		image := Image{
+			key:           key,
+			containerName: containerName,
+			url:           url,
+			tag:           tag,
+			platform:      c.getPlatformFromWorkload(obj, key, annotations, containerName),
 		}
+		images[image] = true
 
 	}
 
-	if len(images) == 0 {
+	if len(images) == 0 && disabled == 0 {
 		c.logger.Warningf("[%s] getImagesFromCurrentWorkload undefined or invalid annotation key=%s\n", c.resource, key)
 	}
 
@@ -92,6 +123,41 @@ func (c *Controller) getImagesFromCurrentWorkload(obj interface{}, key string) (
 
 }
 
+// hasContainer containers 또는 initContainers에 containerName이 있는지 확인
+func hasContainer(obj interface{}, containerName string) bool {
+	if _, err := util.GetContainerByName(obj, containerName); err == nil {
+		return true
+	}
+	if _, err := util.GetInitContainerByName(obj, containerName); err == nil {
+		return true
+	}
+	return false
+}
+
+// getPlatformFromWorkload <watchKey>.platform/<containerName> annotation에서 container의 platform을 추출
+// annotation이 없으면 ""(--image-default-platform)을 반환한다.
+func (c *Controller) getPlatformFromWorkload(obj interface{}, key string, annotations map[string]string, containerName string) string {
+
+	platform := annotations[c.watchKey+platformAnnotation+containerName]
+
+	if platform != platformAuto {
+		return platform
+	}
+
+	spec, err := util.GetPodSpec(obj)
+	if err != nil {
+		c.logger.Warningf("[%s] getPlatformFromWorkload GetPodSpec error key=%s, err=%s\n", c.resource, key, err)
+		return ""
+	}
+
+	if platform, ok := util.GetPlatformFromPodSpec(spec); ok {
+		return platform
+	}
+
+	c.logger.Warningf("[%s] getPlatformFromWorkload platform is not pinned by nodeSelector or nodeAffinity, using default platform key=%s, containerName=%s\n", c.resource, key, containerName)
+	return ""
+}
+
 // getRegisteredImagesFromKey key로 등록되어있는 모든 이미지 추출
 func (c *Controller) getRegisteredImagesFromKey(key string) (images map[Image]bool) {
 
@@ -120,10 +186,11 @@ func (c *Controller) registImage(image Image) {
 	} else {
 		c.logger.Infof("[%s] registImage image=%+v\n", c.resource, image)
 		c.syncedImages[image] = true
+		metrics.SetTrackedImages(c.resource, len(c.syncedImages))
 		c.syncedImagesMutex.Unlock()
 	}
 
-	go c.imageNotifier.RegistImage(c, image.url, image.tag, "") // 이미지 변경 감지 등록
+	go c.imageNotifier.RegistImage(c, image.url, image.tag, image.platform) // 이미지 변경 감지 등록
 
 }
 
@@ -139,8 +206,9 @@ func (c *Controller) unregistImage(image Image) {
 	c.logger.Infof("[%s] unregistImage image=%+v\n", c.resource, image)
 
 	delete(c.syncedImages, image)
+	metrics.SetTrackedImages(c.resource, len(c.syncedImages))
 	c.syncedImagesMutex.Unlock()
 
-	go c.imageNotifier.UnregistImage(c, image.url, image.tag, "") // 이미지 변경 감지 해제
+	go c.imageNotifier.UnregistImage(c, image.url, image.tag, image.platform) // 이미지 변경 감지 해제
 
 }
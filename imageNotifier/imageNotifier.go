@@ -1,21 +1,41 @@
 package imageNotifier
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pubg/kube-image-deployer/interfaces"
 	l "github.com/pubg/kube-image-deployer/logger"
+	"github.com/pubg/kube-image-deployer/util"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+// rateLimitReserve registry의 RateLimit-Remaining이 이 값보다 작으면 window가 지날 때까지 check를 건너뛴다.
+// 같은 IP를 공유하는 kubelet의 image pull에 사용할 여유분을 남겨둔다.
+const rateLimitReserve = 5
+
+// ImageNotifierId registry polling 단위. 같은 image를 여러 controller가 사용해도 1회만 polling 한다.
 type ImageNotifierId struct {
-	controller     interfaces.IController
 	url            string
 	tag            string
 	platformString string // "", "linux/amd64", "linux/386", "linux/arm32", "linux/arm32v7" ...
 }
 
+const (
+	defaultConcurrency         = 10
+	defaultRegistryConcurrency = 3
+	checkJitterRatio           = 0.1         // check interval의 ±10% 범위에서 다음 check 시간을 분산한다.
+	dispatchInterval           = time.Second // check 예정 시간이 지난 image를 찾는 주기
+	defaultCheckTimeout        = 2 * time.Minute
+)
+
+// errCheckTimeout registry가 checkTimeout 내에 응답하지 않았다.
+var errCheckTimeout = errors.New("check timeout")
+
 type ImageNotifier struct {
 	list   map[ImageNotifierId]*ImageUpdateNotify
 	mutex  sync.RWMutex
@@ -23,6 +43,13 @@ type ImageNotifier struct {
 
 	remoteRegistry interfaces.IRemoteRegistry
 	logger         interfaces.ILogger
+	checkInterval  time.Duration
+	resyncInterval time.Duration
+	limiter        *limiter
+	checkTimeout   time.Duration  // image 1개의 check timeout. 지나면 registry 응답을 기다리지 않고 동시성 제한을 반환한다.
+	wg             sync.WaitGroup // 진행중인 check
+	lastTick       int64          // 마지막 dispatch 시간(unix nano). liveness 확인에 사용한다. Start 전에는 0
+	lastCheck      int64          // 마지막 check 완료 시간(unix nano). liveness 확인에 사용한다. Start 전에는 0
 }
 
 func NewImageNotifier(stopCh chan struct{}, remoteRegistry interfaces.IRemoteRegistry, imageCheckIntervalSec uint) *ImageNotifier {
@@ -32,45 +59,87 @@ func NewImageNotifier(stopCh chan struct{}, remoteRegistry interfaces.IRemoteReg
 		stopCh:         stopCh,
 		remoteRegistry: remoteRegistry,
 		logger:         l.NewLogger(),
+		checkInterval:  time.Second * time.Duration(imageCheckIntervalSec),
+		limiter:        newLimiter(defaultConcurrency, defaultRegistryConcurrency),
+		checkTimeout:   defaultCheckTimeout,
 	}
 
-	go wait.Until(r.checkAllImageNotifyList, time.Second*time.Duration(imageCheckIntervalSec), stopCh)
-
 	return r
 }
 
+// Start registry polling loop를 시작한다. leader election을 사용하는 경우 leader가 된 후에 호출한다.
+func (r *ImageNotifier) Start() {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&r.lastTick, now)
+	atomic.StoreInt64(&r.lastCheck, now)
+	go wait.Until(r.checkAllImageNotifyList, dispatchInterval, r.stopCh)
+}
+
 func (r *ImageNotifier) WithLogger(logger interfaces.ILogger) *ImageNotifier {
 	r.logger = logger
 	return r
 }
 
+// WithResyncInterval image string이 바뀌지 않아도 resyncIntervalSec마다 controller에 notify한다. 0이면 비활성화
+func (r *ImageNotifier) WithResyncInterval(resyncIntervalSec uint) *ImageNotifier {
+	r.resyncInterval = time.Second * time.Duration(resyncIntervalSec)
+	return r
+}
+
+// WithConcurrency 전체 동시 check 수와 registry host별 동시 check 수를 제한한다.
+func (r *ImageNotifier) WithConcurrency(concurrency, registryConcurrency uint) *ImageNotifier {
+	r.limiter.setLimit(int(concurrency), int(registryConcurrency))
+	return r
+}
+
+// GetLastTick 마지막으로 dispatch loop가 실행된 시간을 반환한다. Start 전이면 zero time을 반환한다.
+func (r *ImageNotifier) GetLastTick() time.Time {
+	lastTick := atomic.LoadInt64(&r.lastTick)
+	if lastTick == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastTick)
+}
+
+// GetLastCheck 마지막으로 image check가 완료된 시간을 반환한다. 완료된 check가 없으면 Start 시간, Start 전이면 zero time을 반환한다.
+// check할 image가 없으면 dispatch 시간으로 갱신된다.
+func (r *ImageNotifier) GetLastCheck() time.Time {
+	lastCheck := atomic.LoadInt64(&r.lastCheck)
+	if lastCheck == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastCheck)
+}
+
+// GetCheckStallTimeout 이 시간 동안 완료된 check가 없으면 check가 멈춘 것으로 본다.
+// jitter가 적용된 최대 check interval에 check timeout과 dispatch 여유분을 더한 값이다.
+func (r *ImageNotifier) GetCheckStallTimeout() time.Duration {
+	return time.Duration(float64(r.checkInterval)*(1+checkJitterRatio)) + r.checkTimeout + time.Minute
+}
+
 // RegistImage regist to imageNotifier
 func (r *ImageNotifier) RegistImage(controller interfaces.IController, url, tag, platformString string) {
 
-	notifyId := ImageNotifierId{controller: controller, url: url, tag: tag, platformString: platformString}
+	notifyId := ImageNotifierId{url: url, tag: tag, platformString: platformString}
 
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	existsImageUpdateNotify, ok := r.list[notifyId]
+	imageUpdateNotify, ok := r.list[notifyId]
 
-	if ok { // 중복 키?
-		existsImageUpdateNotify.addReferenceCount()
-		return
+	if !ok { // 신규
+		r.logger.Infof("[%s] RegistImage %s:%s platform=%s\n", controller.GetReresourceName(), url, tag, platformString)
+		imageUpdateNotify = NewImageUpdateNotify(url, tag, platformString)
+		r.list[notifyId] = imageUpdateNotify
 	}
 
-	// 신규
-	r.logger.Infof("[%s] RegistImage %s:%s\n", controller.GetReresourceName(), url, tag)
-
-	imageUpdateNotify := NewImageUpdateNotify(url, tag, "", controller)
-
-	r.list[notifyId] = imageUpdateNotify
+	imageUpdateNotify.addReferenceCount(controller)
 }
 
 // UnregistImage unregist from imageNotifier
 func (r *ImageNotifier) UnregistImage(controller interfaces.IController, url, tag, platformString string) {
 
-	notifyId := ImageNotifierId{controller: controller, url: url, tag: tag, platformString: platformString}
+	notifyId := ImageNotifierId{url: url, tag: tag, platformString: platformString}
 
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -82,45 +151,127 @@ func (r *ImageNotifier) UnregistImage(controller interfaces.IController, url, ta
 		return
 	}
 
-	referenceCount := existsImageUpdateNotify.subReferenceCount()
+	if referenceCount := existsImageUpdateNotify.subReferenceCount(controller); referenceCount < 0 {
+		r.logger.Errorf("[%s] UnregistImage subscriber notfound url=%s, tag=%s", controller.GetReresourceName(), url, tag)
+		return
+	}
 
-	if referenceCount <= 0 { // 이미지를 참조하는 대상이 더이상 없으면 삭제
+	if existsImageUpdateNotify.subscriberCount() == 0 { // 이미지를 참조하는 대상이 더이상 없으면 삭제
 		delete(r.list, notifyId)
-		r.logger.Infof("[%s] UnregistImage %s:%s\n", controller.GetReresourceName(), url, tag)
+		r.logger.Infof("[%s] UnregistImage %s:%s platform=%s\n", controller.GetReresourceName(), url, tag, platformString)
+	}
+
+}
+
+// RetryImage controller가 notify 받은 image의 patch에 실패했을 때 호출한다.
+// 다음 check에서 image string이 바뀌지 않았더라도 controller에 다시 notify 한다.
+func (r *ImageNotifier) RetryImage(controller interfaces.IController, url, tag, platformString string) {
+
+	notifyId := ImageNotifierId{url: url, tag: tag, platformString: platformString}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if imageUpdateNotify, ok := r.list[notifyId]; !ok || !imageUpdateNotify.resetNotify(controller) {
+		r.logger.Infof("[%s] RetryImage subscriber notfound url=%s, tag=%s\n", controller.GetReresourceName(), url, tag)
+	}
+}
+
+// NotifyPush registry에 repository:tag가 push 되었음을 알린다. tag가 비어있으면 repository의 모든 tag가 대상이다.
+// 해당 tag 또는 tag pattern을 사용하는 image의 cache를 삭제하고 다음 dispatch에서 즉시 check 한다. check 예정인 image 수를 반환한다.
+// polling loop가 시작되지 않은 경우(leader가 아닌 경우)에도 알림을 받아두고, leader가 되면 check 한다.
+func (r *ImageNotifier) NotifyPush(repository, tag string) (int, error) {
+	name := util.GetRepositoryName(repository)
+	if name == "" {
+		return 0, fmt.Errorf("invalid repository %q", repository)
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	count := 0
+	for _, image := range r.list {
+		if image.repository != name || (tag != "" && image.tag != tag && !util.IsTagPattern(image.tag)) {
+			continue
+		}
+
+		r.remoteRegistry.InvalidateImageString(image.url, tag)
+		image.checkNow()
+		count++
 	}
 
+	if r.GetLastTick().IsZero() {
+		r.logger.Infof("NotifyPush %s:%s, %d images to check after becoming the leader\n", name, tag, count)
+	} else {
+		r.logger.Infof("NotifyPush %s:%s, %d images to check\n", name, tag, count)
+	}
+	return count, nil
 }
 
-func (r *ImageNotifier) checkImageUpdate(image checkImage) {
-	imageString, err := r.remoteRegistry.GetImageString(image.url, image.tag, "")
-	if err != nil {
-		r.logger.Errorf("[%s] checkImageUpdate %s:%s err=%s\n", image.controller.GetReresourceName(), image.url, image.tag, err)
+func (r *ImageNotifier) checkImageUpdate(image *ImageUpdateNotify) {
+	if remaining, ok := r.remoteRegistry.GetRateLimitRemaining(image.url); ok && remaining < rateLimitReserve {
+		r.logger.Infof("checkImageUpdate rate limit backoff %s:%s remaining=%d\n", image.url, image.tag, remaining)
+		return
+	}
+
+	imageString, err := r.getImageString(image)
+
+	if errors.Is(err, util.ErrCircuitOpen) { // breaker가 열리고 닫힐 때 registry에서 1회씩 알린다.
+		r.logger.Infof("checkImageUpdate %s:%s platform=%s skipped err=%s\n", image.url, image.tag, image.platform, err)
+		return
+	} else if err != nil {
+		r.logger.Errorf("checkImageUpdate %s:%s platform=%s err=%s\n", image.url, image.tag, image.platform, err)
 		return
 	}
 
-	image.controller.OnUpdateImageString(image.url, image.tag, image.platformString, imageString)
+	// 변경되었거나 resync 대상인 subscriber에게만 notify
+	for _, controller := range image.getNotifySubscribers(imageString, r.resyncInterval) {
+		controller.OnUpdateImageString(image.url, image.tag, image.platform, imageString)
+	}
 }
 
-type checkImage struct {
-	controller     interfaces.IController
-	url            string
-	tag            string
-	platformString string
+// getImageString checkTimeout 내에 registry가 응답하지 않으면 errCheckTimeout을 반환한다.
+// 응답을 기다리는 goroutine은 registry 요청이 끝나면 종료된다.
+func (r *ImageNotifier) getImageString(image *ImageUpdateNotify) (string, error) {
+	type result struct {
+		imageString string
+		err         error
+	}
+
+	resultCh := make(chan result, 1)
+	go func() {
+		imageString, err := r.remoteRegistry.GetImageString(image.url, image.tag, image.platform)
+		resultCh <- result{imageString, err}
+	}()
+
+	timer := time.NewTimer(r.checkTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-resultCh:
+		return res.imageString, res.err
+	case <-timer.C:
+		return "", fmt.Errorf("%w after %s", errCheckTimeout, r.checkTimeout)
+	}
 }
 
+// checkAllImageNotifyList check 예정 시간이 지난 image를 동시성 제한 내에서 병렬로 check 한다.
+// 제한에 걸린 image는 다음 dispatch에서 다시 시도한다.
 func (r *ImageNotifier) checkAllImageNotifyList() {
 
-	// dump all checkList
-	checkList := func() []checkImage {
-		list := make([]checkImage, 0)
+	now := time.Now()
+	atomic.StoreInt64(&r.lastTick, now.UnixNano())
+
+	// dump due checkList
+	checkList := func() []*ImageUpdateNotify {
+		list := make([]*ImageUpdateNotify, 0)
 		r.mutex.RLock()
+		if len(r.list) == 0 { // check할 image가 없으면 check가 멈춘 것이 아니다.
+			atomic.StoreInt64(&r.lastCheck, now.UnixNano())
+		}
 		for _, imageUpdateNotify := range r.list {
-			if imageUpdateNotify != nil {
-				list = append(list, checkImage{
-					controller: imageUpdateNotify.controller,
-					url:        imageUpdateNotify.url,
-					tag:        imageUpdateNotify.tag,
-				})
+			if imageUpdateNotify != nil && imageUpdateNotify.isDue(now) {
+				list = append(list, imageUpdateNotify)
 			}
 		}
 		r.mutex.RUnlock()
@@ -128,6 +279,29 @@ func (r *ImageNotifier) checkAllImageNotifyList() {
 	}()
 
 	for _, check := range checkList {
-		r.checkImageUpdate(check)
+		if !r.limiter.tryAcquire(check.host) {
+			continue
+		}
+
+		if !check.tryStartCheck(now) {
+			r.limiter.release(check.host)
+			continue
+		}
+
+		r.wg.Add(1)
+		go func(check *ImageUpdateNotify) {
+			defer r.wg.Done()
+			defer r.limiter.release(check.host)
+
+			r.checkImageUpdate(check)
+			check.finishCheck(time.Now().Add(r.getJitteredCheckInterval()))
+			atomic.StoreInt64(&r.lastCheck, time.Now().UnixNano())
+		}(check)
 	}
 }
+
+// getJitteredCheckInterval check interval ±checkJitterRatio 범위의 임의의 시간을 반환한다.
+func (r *ImageNotifier) getJitteredCheckInterval() time.Duration {
+	jitter := time.Duration(float64(r.checkInterval) * checkJitterRatio * (rand.Float64()*2 - 1))
+	return r.checkInterval + jitter
+}
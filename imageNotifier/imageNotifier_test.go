@@ -0,0 +1,357 @@
+package imageNotifier
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/interfaces"
+)
+
+type testRegistry struct {
+	imageString string
+	calledCount int32
+	blockCh     chan struct{} // slow.registry.io 요청을 막는다.
+}
+
+func (r *testRegistry) GetImageString(url, tag, platformString string) (string, error) {
+	atomic.AddInt32(&r.calledCount, 1)
+	if r.blockCh != nil && strings.HasPrefix(url, "slow.registry.io/") {
+		<-r.blockCh
+	}
+	return r.imageString, nil
+}
+
+func (r *testRegistry) GetRateLimitRemaining(url string) (int, bool) {
+	return 0, false
+}
+
+func (r *testRegistry) InvalidateImageString(url, tag string) {}
+
+type testController struct {
+	name     string
+	notified []string
+	mutex    sync.Mutex
+}
+
+func (c *testController) Run(workers int, stopCh chan struct{}) {}
+
+func (c *testController) OnUpdateImageString(url, tag, platformString, imageString string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.notified = append(c.notified, imageString)
+}
+
+func (c *testController) GetReresourceName() string {
+	return c.name
+}
+
+func (c *testController) notifiedCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.notified)
+}
+
+// newTestImageNotifier dispatch loop 없이(Start 하지 않고) ImageNotifier를 생성한다. check는 checkAllNow로 수행한다.
+func newTestImageNotifier(registry interfaces.IRemoteRegistry) *ImageNotifier {
+	stopCh := make(chan struct{})
+	close(stopCh)
+	return NewImageNotifier(stopCh, registry, 3600)
+}
+
+// checkAllNow 모든 image를 check 예정 시간과 관계없이 check 하고 완료될 때까지 기다린다.
+func checkAllNow(r *ImageNotifier) {
+	r.mutex.RLock()
+	for _, imageUpdateNotify := range r.list {
+		imageUpdateNotify.finishCheck(time.Time{})
+	}
+	r.mutex.RUnlock()
+
+	r.checkAllImageNotifyList()
+	r.wg.Wait()
+}
+
+// 여러 controller가 같은 image를 사용해도 registry는 1회만 조회하고 모든 controller에게 notify 해야 한다.
+func TestImageNotifierDeduplicate(t *testing.T) {
+	registry := &testRegistry{imageString: "busybox@sha256:1"}
+	r := newTestImageNotifier(registry)
+
+	deployments := &testController{name: "deployments"}
+	statefulsets := &testController{name: "statefulsets"}
+
+	r.RegistImage(deployments, "busybox", "1.34.*", "")
+	r.RegistImage(deployments, "busybox", "1.34.*", "")
+	r.RegistImage(statefulsets, "busybox", "1.34.*", "")
+
+	atomic.StoreInt32(&registry.calledCount, 0)
+	checkAllNow(r)
+
+	if registry.calledCount != 1 {
+		t.Fatalf("Expected: 1 registry call, Got: %d", registry.calledCount)
+	}
+
+	if deployments.notifiedCount() != 1 || statefulsets.notifiedCount() != 1 {
+		t.Fatalf("Expected: 1 notify per controller, Got: %d, %d", deployments.notifiedCount(), statefulsets.notifiedCount())
+	}
+
+	r.UnregistImage(deployments, "busybox", "1.34.*", "")
+	r.UnregistImage(statefulsets, "busybox", "1.34.*", "")
+
+	if len(r.list) != 1 {
+		t.Fatalf("Expected: deployments still subscribed, Got: %d", len(r.list))
+	}
+
+	r.UnregistImage(deployments, "busybox", "1.34.*", "")
+
+	if len(r.list) != 0 {
+		t.Fatalf("Expected: empty list, Got: %d", len(r.list))
+	}
+}
+
+// image string이 바뀐 경우에만 notify 해야 한다.
+func TestImageNotifierNotifyOnlyChanged(t *testing.T) {
+	registry := &testRegistry{imageString: "busybox@sha256:1"}
+	r := newTestImageNotifier(registry)
+
+	c := &testController{name: "deployments"}
+	r.RegistImage(c, "busybox", "latest", "")
+
+	checkAllNow(r)
+	checkAllNow(r)
+
+	if c.notifiedCount() != 1 {
+		t.Fatalf("Expected: 1 notify, Got: %d", c.notifiedCount())
+	}
+
+	registry.imageString = "busybox@sha256:2"
+	checkAllNow(r)
+
+	if c.notifiedCount() != 2 {
+		t.Fatalf("Expected: 2 notify, Got: %d", c.notifiedCount())
+	}
+
+	// 새 workload가 같은 image를 참조하면 변경이 없어도 다시 notify
+	r.RegistImage(c, "busybox", "latest", "")
+	checkAllNow(r)
+
+	if c.notifiedCount() != 3 {
+		t.Fatalf("Expected: 3 notify, Got: %d", c.notifiedCount())
+	}
+}
+
+// RetryImage를 호출하면 image string이 같더라도 다음 check에서 다시 notify 해야 한다.
+func TestImageNotifierRetryImage(t *testing.T) {
+	r := newTestImageNotifier(&testRegistry{imageString: "busybox@sha256:1"})
+
+	deployments := &testController{name: "deployments"}
+	statefulsets := &testController{name: "statefulsets"}
+	r.RegistImage(deployments, "busybox", "latest", "")
+	r.RegistImage(statefulsets, "busybox", "latest", "")
+	checkAllNow(r)
+
+	r.RetryImage(deployments, "busybox", "latest", "") // patch 실패
+	checkAllNow(r)
+
+	if deployments.notifiedCount() != 2 || statefulsets.notifiedCount() != 1 {
+		t.Fatalf("Expected: only deployments notified again, Got: %d, %d", deployments.notifiedCount(), statefulsets.notifiedCount())
+	}
+}
+
+// 느린 registry는 registry별 동시성 제한만큼만 점유하고, 다른 registry의 check는 계속 진행되어야 한다.
+func TestImageNotifierSlowRegistry(t *testing.T) {
+	registry := &testRegistry{imageString: "image@sha256:1", blockCh: make(chan struct{})}
+	r := newTestImageNotifier(registry)
+	r.WithConcurrency(4, 2)
+
+	slow := &testController{name: "slow"}
+	fast := &testController{name: "fast"}
+
+	for _, tag := range []string{"1", "2", "3"} {
+		r.RegistImage(slow, "slow.registry.io/app", tag, "")
+	}
+	r.RegistImage(fast, "busybox", "latest", "")
+
+	r.checkAllImageNotifyList()
+
+	if !waitFor(func() bool { return fast.notifiedCount() == 1 }) {
+		t.Fatalf("Expected: fast registry notified while slow registry is blocked")
+	}
+
+	if !waitFor(func() bool { return atomic.LoadInt32(&registry.calledCount) == 3 }) {
+		t.Fatalf("Expected: 2 slow + 1 fast registry calls, Got: %d", atomic.LoadInt32(&registry.calledCount))
+	}
+
+	close(registry.blockCh)
+	r.wg.Wait()
+
+	r.WithConcurrency(4, 3) // 제한에 걸려 check 하지 못한 tag까지 check
+	checkAllNow(r)
+
+	if slow.notifiedCount() != 3 {
+		t.Fatalf("Expected: slow registry notified once per tag, Got: %d", slow.notifiedCount())
+	}
+}
+
+// 응답하지 않는 registry의 check는 checkTimeout이 지나면 registry 동시성 제한을 반환하고 다음 check를 예약해야 한다.
+func TestImageNotifierCheckTimeout(t *testing.T) {
+	registry := &testRegistry{imageString: "image@sha256:1", blockCh: make(chan struct{})}
+	defer close(registry.blockCh)
+
+	r := newTestImageNotifier(registry)
+	r.WithConcurrency(4, 1)
+	r.checkTimeout = 50 * time.Millisecond
+
+	slow := &testController{name: "slow"}
+	r.RegistImage(slow, "slow.registry.io/app", "1", "")
+	r.RegistImage(slow, "slow.registry.io/app", "2", "")
+
+	checkAllNow(r) // 제한이 1이므로 tag 1개만 check 하고 timeout 된다.
+
+	if atomic.LoadInt32(&registry.calledCount) != 1 {
+		t.Fatalf("Expected: 1 registry call, Got: %d", atomic.LoadInt32(&registry.calledCount))
+	}
+
+	if !r.limiter.tryAcquire("slow.registry.io") {
+		t.Fatalf("Expected: registry slot released after check timeout")
+	}
+	r.limiter.release("slow.registry.io")
+
+	checkAllNow(r) // timeout 된 check는 진행중으로 남지 않아야 한다.
+
+	if atomic.LoadInt32(&registry.calledCount) != 2 {
+		t.Fatalf("Expected: 2 registry calls, Got: %d", atomic.LoadInt32(&registry.calledCount))
+	}
+
+	if slow.notifiedCount() != 0 {
+		t.Fatalf("Expected: no notify on timeout, Got: %d", slow.notifiedCount())
+	}
+}
+
+// dispatch loop가 실행될 때마다 lastTick이 갱신되어야 한다.
+func TestImageNotifierLastTick(t *testing.T) {
+	r := newTestImageNotifier(&testRegistry{imageString: "busybox@sha256:1"})
+
+	if !r.GetLastTick().IsZero() {
+		t.Fatalf("Expected: zero lastTick before Start, Got: %s", r.GetLastTick())
+	}
+
+	r.Start() // stopCh가 닫혀 있으므로 loop는 실행되지 않는다.
+	before := r.GetLastTick()
+	time.Sleep(10 * time.Millisecond)
+	checkAllNow(r)
+
+	if !r.GetLastTick().After(before) {
+		t.Fatalf("Expected: lastTick updated, Got: %s <= %s", r.GetLastTick(), before)
+	}
+}
+
+// check가 완료될 때와 check할 image가 없을 때 lastCheck가 갱신되어야 하고, 진행중인 check만 있으면 갱신되지 않아야 한다.
+func TestImageNotifierLastCheck(t *testing.T) {
+	registry := &testRegistry{imageString: "image@sha256:1", blockCh: make(chan struct{})}
+	r := newTestImageNotifier(registry)
+
+	if !r.GetLastCheck().IsZero() {
+		t.Fatalf("Expected: zero lastCheck before Start, Got: %s", r.GetLastCheck())
+	}
+
+	r.Start()
+	stale := time.Now().Add(-time.Hour)
+	atomic.StoreInt64(&r.lastCheck, stale.UnixNano())
+
+	r.checkAllImageNotifyList() // image가 없다.
+	if !r.GetLastCheck().After(stale) {
+		t.Fatalf("Expected: lastCheck updated without images, Got: %s", r.GetLastCheck())
+	}
+
+	c := &testController{name: "c"}
+	r.RegistImage(c, "slow.registry.io/app", "1", "")
+	atomic.StoreInt64(&r.lastCheck, stale.UnixNano())
+
+	r.checkAllImageNotifyList()
+	if !waitFor(func() bool { return atomic.LoadInt32(&registry.calledCount) == 1 }) {
+		t.Fatalf("Expected: 1 registry call")
+	}
+	if !r.GetLastCheck().Equal(stale) {
+		t.Fatalf("Expected: lastCheck not updated while the check is running, Got: %s", r.GetLastCheck())
+	}
+
+	close(registry.blockCh)
+	r.wg.Wait()
+	if !r.GetLastCheck().After(stale) {
+		t.Fatalf("Expected: lastCheck updated after the check, Got: %s", r.GetLastCheck())
+	}
+}
+
+// push 알림은 같은 repository의 같은 tag와 tag pattern만 즉시 check 해야 한다.
+func TestImageNotifierNotifyPush(t *testing.T) {
+	r := newTestImageNotifier(&testRegistry{imageString: "busybox@sha256:1"})
+	c := &testController{name: "deployments"}
+
+	if _, err := r.NotifyPush("", "latest"); err == nil {
+		t.Fatalf("Expected: invalid repository error")
+	}
+
+	r.RegistImage(c, "busybox", "latest", "")
+	r.RegistImage(c, "busybox", "1.34.*", "")
+	r.RegistImage(c, "busybox", "stable", "")
+	r.RegistImage(c, "registry.io/busybox", "latest", "")
+	checkAllNow(r)
+
+	r.mutex.RLock()
+	for _, image := range r.list {
+		image.finishCheck(time.Now().Add(time.Hour))
+	}
+	r.mutex.RUnlock()
+
+	count, err := r.NotifyPush("docker.io/library/busybox", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected: busybox:latest and busybox:1.34.*, Got: %d", count)
+	}
+
+	due := make([]string, 0)
+	for id, image := range r.list {
+		if image.isDue(time.Now()) {
+			due = append(due, id.url+":"+id.tag)
+		}
+	}
+	if len(due) != 2 {
+		t.Fatalf("Expected: 2 due images, Got: %v", due)
+	}
+}
+
+// leader가 아닌 경우에도 push 알림을 받아두고, leader가 되면 즉시 check 해야 한다.
+func TestImageNotifierNotifyPushFollower(t *testing.T) {
+	r := newTestImageNotifier(&testRegistry{imageString: "busybox@sha256:1"})
+	r.RegistImage(&testController{name: "deployments"}, "busybox", "latest", "")
+
+	r.mutex.RLock()
+	for _, image := range r.list {
+		image.finishCheck(time.Now().Add(time.Hour))
+	}
+	r.mutex.RUnlock()
+
+	if count, err := r.NotifyPush("busybox", "latest"); err != nil || count != 1 {
+		t.Fatalf("Expected: 1 image accepted before Start, Got: %d, %v", count, err)
+	}
+
+	for _, image := range r.list {
+		if !image.isDue(time.Now()) {
+			t.Fatalf("Expected: due image")
+		}
+	}
+}
+
+func waitFor(f func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if f() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
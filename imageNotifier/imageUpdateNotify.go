@@ -1,33 +1,161 @@
 package imageNotifier
 
 import (
-	"sync/atomic"
+	"sync"
+	"time"
 
 	"github.com/pubg/kube-image-deployer/interfaces"
+	"github.com/pubg/kube-image-deployer/util"
 )
 
+// ImageUpdateNotify url, tag, platform 하나를 구독하는 controller 목록
+// registry polling은 ImageUpdateNotify 단위로 1회만 수행하고 결과를 모든 subscriber에게 전달한다.
 type ImageUpdateNotify struct {
-	url            string
-	tag            string
-	platform       string
-	controller     interfaces.IController
+	url         string
+	tag         string
+	platform    string
+	host        string // registry host
+	repository  string // 정규화된 repository 이름. push 알림과 비교한다.
+	subscribers map[interfaces.IController]*subscriber
+	nextCheck   time.Time // 다음 check 예정 시간
+	checking    bool      // check 진행중
+	recheck     bool      // check 진행중 push 알림을 받음. 완료 후 즉시 다시 check 한다.
+	mutex       sync.Mutex
+}
+
+type subscriber struct {
 	referenceCount int32
+	imageString    string    // 마지막으로 notify한 image string
+	notifiedAt     time.Time // 마지막 notify 시간
 }
 
-func NewImageUpdateNotify(url, tag, platform string, controller interfaces.IController) *ImageUpdateNotify {
+func NewImageUpdateNotify(url, tag, platform string) *ImageUpdateNotify {
 	return &ImageUpdateNotify{
-		url:            url,
-		tag:            tag,
-		platform:       platform,
-		controller:     controller,
-		referenceCount: 1,
+		url:         url,
+		tag:         tag,
+		platform:    platform,
+		host:        util.GetRegistryHost(url),
+		repository:  util.GetRepositoryName(url),
+		subscribers: make(map[interfaces.IController]*subscriber),
+		mutex:       sync.Mutex{},
+	}
+}
+
+// addReferenceCount controller의 참조 카운트를 증가시킨다.
+// 새로 참조한 workload도 patch 되도록 다음 check에서 imageString이 같더라도 notify한다.
+func (u *ImageUpdateNotify) addReferenceCount(controller interfaces.IController) int32 {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	s, ok := u.subscribers[controller]
+	if !ok {
+		s = &subscriber{}
+		u.subscribers[controller] = s
+	}
+
+	s.referenceCount++
+	s.imageString = ""
+	u.nextCheck = time.Time{} // 즉시 check
+	return s.referenceCount
+}
+
+// subReferenceCount controller의 참조 카운트를 감소시키고, 0이 되면 subscriber에서 제거한다.
+// 등록되지 않은 controller인 경우 -1을 반환한다.
+func (u *ImageUpdateNotify) subReferenceCount(controller interfaces.IController) int32 {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	s, ok := u.subscribers[controller]
+	if !ok {
+		return -1
+	}
+
+	s.referenceCount--
+	if s.referenceCount <= 0 {
+		delete(u.subscribers, controller)
+	}
+	return s.referenceCount
+}
+
+// resetNotify controller에 마지막으로 notify한 image string을 지운다. 다음 check에서 imageString이 같더라도 다시 notify한다.
+func (u *ImageUpdateNotify) resetNotify(controller interfaces.IController) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	s, ok := u.subscribers[controller]
+	if !ok {
+		return false
+	}
+
+	s.imageString = ""
+	return true
+}
+
+func (u *ImageUpdateNotify) subscriberCount() int {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return len(u.subscribers)
+}
+
+// getNotifySubscribers imageString이 마지막 notify와 다르거나, resyncInterval이 지난 subscriber 목록을 반환하고 notify 상태를 갱신한다.
+// resyncInterval이 0이면 강제 resync를 하지 않는다.
+func (u *ImageUpdateNotify) getNotifySubscribers(imageString string, resyncInterval time.Duration) []interfaces.IController {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	controllers := make([]interfaces.IController, 0)
+
+	for controller, s := range u.subscribers {
+		if imageString == s.imageString && (resyncInterval == 0 || time.Since(s.notifiedAt) < resyncInterval) {
+			continue
+		}
+
+		s.imageString = imageString
+		s.notifiedAt = time.Now()
+		controllers = append(controllers, controller)
 	}
+
+	return controllers
 }
 
-func (u *ImageUpdateNotify) addReferenceCount() int32 {
-	return atomic.AddInt32(&u.referenceCount, 1)
+// tryStartCheck check 예정 시간이 지났고 진행중인 check가 없으면 check 진행중으로 표시하고 true를 반환한다.
+func (u *ImageUpdateNotify) tryStartCheck(now time.Time) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.checking || now.Before(u.nextCheck) {
+		return false
+	}
+
+	u.checking = true
+	return true
+}
+
+// finishCheck check 완료 후 다음 check 예정 시간을 설정한다.
+func (u *ImageUpdateNotify) finishCheck(nextCheck time.Time) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.checking = false
+	u.nextCheck = nextCheck
+	if u.recheck { // check 중에 push 된 image
+		u.nextCheck = time.Time{}
+		u.recheck = false
+	}
 }
 
-func (u *ImageUpdateNotify) subReferenceCount() int32 {
-	return atomic.AddInt32(&u.referenceCount, -1)
+// checkNow 다음 dispatch에서 즉시 check 하도록 한다. 진행중인 check가 있으면 완료 후 다시 check 한다.
+func (u *ImageUpdateNotify) checkNow() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.nextCheck = time.Time{}
+	u.recheck = u.checking
+}
+
+func (u *ImageUpdateNotify) isDue(now time.Time) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return !u.checking && !now.Before(u.nextCheck)
 }
@@ -0,0 +1,59 @@
+package imageNotifier
+
+import "sync"
+
+// limiter 전체 동시 check 수와 registry host별 동시 check 수를 제한한다.
+// 느린 registry가 registry 제한만큼만 점유하므로 다른 registry의 check는 계속 진행된다.
+type limiter struct {
+	limit           int
+	registryLimit   int
+	running         int
+	registryRunning map[string]int
+	mutex           sync.Mutex
+}
+
+func newLimiter(limit, registryLimit int) *limiter {
+	l := &limiter{
+		registryRunning: make(map[string]int),
+		mutex:           sync.Mutex{},
+	}
+	l.setLimit(limit, registryLimit)
+	return l
+}
+
+func (l *limiter) setLimit(limit, registryLimit int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if limit < 1 {
+		limit = 1
+	}
+	if registryLimit < 1 {
+		registryLimit = 1
+	}
+	l.limit, l.registryLimit = limit, registryLimit
+}
+
+// tryAcquire 제한에 걸리지 않으면 실행 슬롯을 점유하고 true를 반환한다. 대기하지 않는다.
+func (l *limiter) tryAcquire(host string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.running >= l.limit || l.registryRunning[host] >= l.registryLimit {
+		return false
+	}
+
+	l.running++
+	l.registryRunning[host]++
+	return true
+}
+
+func (l *limiter) release(host string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.running--
+	if l.registryRunning[host]--; l.registryRunning[host] <= 0 {
+		delete(l.registryRunning, host)
+	}
+}
@@ -9,10 +9,19 @@ type IController interface {
 type IImageNotifier interface {
 	RegistImage(c IController, url, tag, platformString string)
 	UnregistImage(c IController, url, tag, platformString string)
+	RetryImage(c IController, url, tag, platformString string)
 }
 
 type IRemoteRegistry interface {
 	GetImageString(url, tag, platformString string) (string, error)
+	GetRateLimitRemaining(url string) (remaining int, ok bool)
+	InvalidateImageString(url, tag string)
+}
+
+type IAnnotationSource interface {
+	GetAnnotations(resource string, obj interface{}) map[string]string
+	OnImageResolved(url, tag, platformString, imageString string)
+	OnImagePatched(resource string, obj interface{}, containerName, imageString string)
 }
 
 type ILogger interface {
@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"sync"
 	"syscall"
+	_ "time/tzdata" // deploy window time zones on alpine without zoneinfo
 
 	"github.com/joho/godotenv"
 	"github.com/pubg/kube-image-deployer/logger"
+	"github.com/pubg/kube-image-deployer/metrics"
+	"github.com/pubg/kube-image-deployer/util"
 	"github.com/pubg/kube-image-deployer/watcher"
+	"github.com/pubg/kube-image-deployer/webhook"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -19,18 +25,38 @@ import (
 )
 
 var (
-	kubeconfig               = *flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	offDeployments           = *flag.Bool("off-deployments", false, "disable deployments")
-	offStatefulsets          = *flag.Bool("off-statefulsets", false, "disable statefulsets")
-	offDaemonsets            = *flag.Bool("off-daemonsets", false, "disable daemonsets")
-	offCronjobs              = *flag.Bool("off-cronjobs", false, "disable cronjobs")
-	imageStringCacheTTLSec   = *flag.Uint("image-hash-cache-ttl-sec", 60, "image hash cache TTL in seconds")
-	imageCheckIntervalSec    = *flag.Uint("image-check-interval-sec", 10, "image check interval in seconds")
-	controllerWatchKey       = *flag.String("controller-watch-key", "kube-image-deployer", "controller watch key")
-	controllerWatchNamespace = *flag.String("controller-watch-namespace", "", "controller watch namespace. If empty, watch all namespaces")
-	imageDefaultPlatform     = *flag.String("image-default-platform", "linux/amd64", "default platform for docker images")
-	slackWebhook             = *flag.String("slack-webhook", "", "slack webhook url. If empty, notifications are disabled")
-	slackMsgPrefix           = *flag.String("slack-msg-prefix", "["+getHostname()+"]", "slack message prefix. default=[hostname]")
+	kubeconfig                    = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	offDeployments                = flag.Bool("off-deployments", false, "disable deployments")
+	offStatefulsets               = flag.Bool("off-statefulsets", false, "disable statefulsets")
+	offDaemonsets                 = flag.Bool("off-daemonsets", false, "disable daemonsets")
+	offCronjobs                   = flag.Bool("off-cronjobs", false, "disable cronjobs")
+	useCronjobV1                  = flag.String("use-cronjob-v1", "", "watch batch/v1 CronJobs (true) or batch/v1beta1 CronJobs (false). If empty, detected by API discovery")
+	imageStringCacheTTLSec        = flag.Uint("image-hash-cache-ttl-sec", 60, "image hash cache TTL in seconds")
+	imageCheckIntervalSec         = flag.Uint("image-check-interval-sec", 10, "image check interval in seconds")
+	imageResyncIntervalSec        = flag.Uint("image-resync-interval-sec", 3600, "interval in seconds to notify controllers even if the image is not changed. If 0, disabled")
+	imageCheckConcurrency         = flag.Uint("image-check-concurrency", 10, "maximum number of concurrent image checks")
+	imageCheckRegistryConcurrency = flag.Uint("image-check-registry-concurrency", 3, "maximum number of concurrent image checks per registry host")
+	controllerWatchKey            = flag.String("controller-watch-key", "kube-image-deployer", "controller watch key")
+	controllerWatchNamespace      = flag.String("controller-watch-namespace", "", "controller watch namespace. If empty, watch all namespaces")
+	imageDefaultPlatform          = flag.String("image-default-platform", "linux/amd64", "default platform for docker images. 'index' resolves the multi-arch manifest list digest")
+	slackWebhook                  = flag.String("slack-webhook", "", "slack webhook url. If empty, notifications are disabled")
+	slackMsgPrefix                = flag.String("slack-msg-prefix", "["+getHostname()+"]", "slack message prefix. default=[hostname]")
+	dryRun                        = flag.Bool("dry-run", false, "send patches as server-side dry-run. Patches are logged and recorded as events but not persisted")
+	rolloutDeadlineSec            = flag.Uint("rollout-deadline-sec", 0, "roll back a patch if the rollout does not complete in seconds. If 0, disabled unless the workload is annotated")
+	leaderElect                   = flag.Bool("leader-elect", false, "enable leader election. Only the leader polls registries and patches workloads")
+	leaderElectLeaseName          = flag.String("leader-elect-lease-name", "kube-image-deployer", "leader election lease name")
+	leaderElectLeaseNamespace     = flag.String("leader-elect-lease-namespace", "kube-image-deployer", "leader election lease namespace. default=$POD_NAMESPACE")
+	leaderElectLeaseDurationSec   = flag.Uint("leader-elect-lease-duration-sec", 15, "leader election lease duration in seconds")
+	leaderElectRenewDeadlineSec   = flag.Uint("leader-elect-renew-deadline-sec", 10, "leader election renew deadline in seconds")
+	leaderElectRetryPeriodSec     = flag.Uint("leader-elect-retry-period-sec", 2, "leader election retry period in seconds")
+	httpAddr                      = flag.String("http-addr", ":8080", "http server address for /metrics, /healthz, /readyz and /webhook. If empty, disabled")
+	webhookToken                  = flag.String("webhook-token", "", "shared token for registry push webhooks on /webhook. If both token and hmac secret are empty, webhooks are disabled")
+	webhookHMACSecret             = flag.String("webhook-hmac-secret", "", "secret for HMAC-SHA256 signed registry push webhooks on /webhook")
+	imagePolicy                   = flag.Bool("image-policy", false, "watch ImagePolicy custom resources in addition to workload annotations")
+	genericWorkloads              = flag.String("generic-workloads", "", "comma separated custom resources with a pod template to watch. <resource>.<version>.<group>=<JSONPath to the pod template>")
+	watchJobs                     = flag.Bool("watch-jobs", false, "watch Jobs which are not owned by a CronJob")
+	watchReplicaSets              = flag.Bool("watch-replicasets", false, "watch ReplicaSets which are not owned by a Deployment")
+	updateStrategies              = flag.String("update-strategies", "", "comma separated update strategies of jobs and replicasets. jobs=recreate|configmap|patch, replicasets=patch|recreate")
 )
 
 func getHostname() string {
@@ -42,90 +68,188 @@ func getHostname() string {
 
 func init() {
 	klog.InitFlags(nil)
-	flag.Parse()
-	klog.Infof("Starting pid: %d", os.Getpid())
 	godotenv.Load(".env")
 
+	// environment variables are applied before flag.Parse, so command line flags take precedence
 	if os.Getenv("KUBECONFIG_PATH") != "" {
-		kubeconfig = os.Getenv("KUBECONFIG_PATH")
+		*kubeconfig = os.Getenv("KUBECONFIG_PATH")
 	}
 	if os.Getenv("OFF_DEPLOYMENTS") != "" {
-		offDeployments = true
+		*offDeployments = true
 	}
 	if os.Getenv("OFF_STATEFULSETS") != "" {
-		offStatefulsets = true
+		*offStatefulsets = true
 	}
 	if os.Getenv("OFF_DAEMONSETS") != "" {
-		offDaemonsets = true
+		*offDaemonsets = true
 	}
 	if os.Getenv("OFF_CRONJOBS") != "" {
-		offCronjobs = true
+		*offCronjobs = true
+	}
+	if os.Getenv("USE_CRONJOB_V1") != "" {
+		*useCronjobV1 = os.Getenv("USE_CRONJOB_V1")
 	}
 	if os.Getenv("IMAGE_HASH_CACHE_TTL_SEC") != "" {
 		if v, err := strconv.ParseUint(os.Getenv("IMAGE_HASH_CACHE_TTL_SEC"), 10, 32); err == nil {
-			imageStringCacheTTLSec = uint(v)
+			*imageStringCacheTTLSec = uint(v)
 		}
 	}
 	if os.Getenv("IMAGE_CHECK_INTERVAL_SEC") != "" {
 		if v, err := strconv.ParseUint(os.Getenv("IMAGE_CHECK_INTERVAL_SEC"), 10, 32); err == nil {
-			imageCheckIntervalSec = uint(v)
+			*imageCheckIntervalSec = uint(v)
+		}
+	}
+	if os.Getenv("IMAGE_RESYNC_INTERVAL_SEC") != "" {
+		if v, err := strconv.ParseUint(os.Getenv("IMAGE_RESYNC_INTERVAL_SEC"), 10, 32); err == nil {
+			*imageResyncIntervalSec = uint(v)
+		}
+	}
+	if os.Getenv("IMAGE_CHECK_CONCURRENCY") != "" {
+		if v, err := strconv.ParseUint(os.Getenv("IMAGE_CHECK_CONCURRENCY"), 10, 32); err == nil {
+			*imageCheckConcurrency = uint(v)
+		}
+	}
+	if os.Getenv("IMAGE_CHECK_REGISTRY_CONCURRENCY") != "" {
+		if v, err := strconv.ParseUint(os.Getenv("IMAGE_CHECK_REGISTRY_CONCURRENCY"), 10, 32); err == nil {
+			*imageCheckRegistryConcurrency = uint(v)
 		}
 	}
 	if os.Getenv("CONTROLLER_WATCH_KEY") != "" {
-		controllerWatchKey = os.Getenv("CONTROLLER_WATCH_KEY")
+		*controllerWatchKey = os.Getenv("CONTROLLER_WATCH_KEY")
 	}
 	if os.Getenv("CONTROLLER_WATCH_NAMESPACE") != "" {
-		controllerWatchNamespace = os.Getenv("CONTROLLER_WATCH_NAMESPACE")
+		*controllerWatchNamespace = os.Getenv("CONTROLLER_WATCH_NAMESPACE")
 	}
 	if os.Getenv("IMAGE_DEFAULT_PLATFORM") != "" {
-		imageDefaultPlatform = os.Getenv("IMAGE_DEFAULT_PLATFORM")
+		*imageDefaultPlatform = os.Getenv("IMAGE_DEFAULT_PLATFORM")
 	}
 	if os.Getenv("SLACK_WEBHOOK") != "" {
-		slackWebhook = os.Getenv("SLACK_WEBHOOK")
+		*slackWebhook = os.Getenv("SLACK_WEBHOOK")
 	}
 	if os.Getenv("SLACK_MSG_PREFIX") != "" {
-		slackMsgPrefix = os.Getenv("SLACK_MSG_PREFIX")
+		*slackMsgPrefix = os.Getenv("SLACK_MSG_PREFIX")
+	}
+	if os.Getenv("DRY_RUN") != "" {
+		*dryRun = true
+	}
+	if os.Getenv("ROLLOUT_DEADLINE_SEC") != "" {
+		if v, err := strconv.ParseUint(os.Getenv("ROLLOUT_DEADLINE_SEC"), 10, 32); err == nil {
+			*rolloutDeadlineSec = uint(v)
+		}
+	}
+	if os.Getenv("LEADER_ELECT") != "" {
+		*leaderElect = true
+	}
+	if os.Getenv("LEADER_ELECT_LEASE_NAME") != "" {
+		*leaderElectLeaseName = os.Getenv("LEADER_ELECT_LEASE_NAME")
+	}
+	if os.Getenv("LEADER_ELECT_LEASE_NAMESPACE") != "" {
+		*leaderElectLeaseNamespace = os.Getenv("LEADER_ELECT_LEASE_NAMESPACE")
+	} else if os.Getenv("POD_NAMESPACE") != "" {
+		*leaderElectLeaseNamespace = os.Getenv("POD_NAMESPACE")
+	}
+	if os.Getenv("LEADER_ELECT_LEASE_DURATION_SEC") != "" {
+		if v, err := strconv.ParseUint(os.Getenv("LEADER_ELECT_LEASE_DURATION_SEC"), 10, 32); err == nil {
+			*leaderElectLeaseDurationSec = uint(v)
+		}
+	}
+	if os.Getenv("LEADER_ELECT_RENEW_DEADLINE_SEC") != "" {
+		if v, err := strconv.ParseUint(os.Getenv("LEADER_ELECT_RENEW_DEADLINE_SEC"), 10, 32); err == nil {
+			*leaderElectRenewDeadlineSec = uint(v)
+		}
+	}
+	if os.Getenv("LEADER_ELECT_RETRY_PERIOD_SEC") != "" {
+		if v, err := strconv.ParseUint(os.Getenv("LEADER_ELECT_RETRY_PERIOD_SEC"), 10, 32); err == nil {
+			*leaderElectRetryPeriodSec = uint(v)
+		}
+	}
+	if v, ok := os.LookupEnv("HTTP_ADDR"); ok { // empty value disables the http server
+		*httpAddr = v
+	}
+	if os.Getenv("WEBHOOK_TOKEN") != "" {
+		*webhookToken = os.Getenv("WEBHOOK_TOKEN")
+	}
+	if os.Getenv("WEBHOOK_HMAC_SECRET") != "" {
+		*webhookHMACSecret = os.Getenv("WEBHOOK_HMAC_SECRET")
+	}
+	if os.Getenv("IMAGE_POLICY") != "" {
+		*imagePolicy = true
+	}
+	if os.Getenv("GENERIC_WORKLOADS") != "" {
+		*genericWorkloads = os.Getenv("GENERIC_WORKLOADS")
+	}
+	if os.Getenv("WATCH_JOBS") != "" {
+		*watchJobs = true
+	}
+	if os.Getenv("WATCH_REPLICASETS") != "" {
+		*watchReplicaSets = true
+	}
+	if os.Getenv("UPDATE_STRATEGIES") != "" {
+		*updateStrategies = os.Getenv("UPDATE_STRATEGIES")
 	}
 
+	flag.Parse()
+	klog.Infof("Starting pid: %d", os.Getpid())
+
 	klog.Infof("Config Flags: %v", map[string]interface{}{
-		"kubeconfig":               kubeconfig,
-		"offDeployments":           offDeployments,
-		"offStatefulsets":          offStatefulsets,
-		"offDaemonsets":            offDaemonsets,
-		"offCronjobs":              offCronjobs,
-		"imageStringCacheTTLSec":   imageStringCacheTTLSec,
-		"imageCheckIntervalSec":    imageCheckIntervalSec,
-		"controllerWatchKey":       controllerWatchKey,
-		"controllerWatchNamespace": controllerWatchNamespace,
-		"slackWebhook":             slackWebhook,
-		"slackMsgPrefix":           slackMsgPrefix,
+		"kubeconfig":                    *kubeconfig,
+		"offDeployments":                *offDeployments,
+		"offStatefulsets":               *offStatefulsets,
+		"offDaemonsets":                 *offDaemonsets,
+		"offCronjobs":                   *offCronjobs,
+		"useCronjobV1":                  *useCronjobV1,
+		"imageStringCacheTTLSec":        *imageStringCacheTTLSec,
+		"imageCheckIntervalSec":         *imageCheckIntervalSec,
+		"imageResyncIntervalSec":        *imageResyncIntervalSec,
+		"imageCheckConcurrency":         *imageCheckConcurrency,
+		"imageCheckRegistryConcurrency": *imageCheckRegistryConcurrency,
+		"controllerWatchKey":            *controllerWatchKey,
+		"controllerWatchNamespace":      *controllerWatchNamespace,
+		"slackWebhook":                  *slackWebhook,
+		"slackMsgPrefix":                *slackMsgPrefix,
+		"dryRun":                        *dryRun,
+		"rolloutDeadlineSec":            *rolloutDeadlineSec,
+		"leaderElect":                   *leaderElect,
+		"leaderElectLeaseName":          *leaderElectLeaseName,
+		"leaderElectLeaseNamespace":     *leaderElectLeaseNamespace,
+		"leaderElectLeaseDurationSec":   *leaderElectLeaseDurationSec,
+		"leaderElectRenewDeadlineSec":   *leaderElectRenewDeadlineSec,
+		"leaderElectRetryPeriodSec":     *leaderElectRetryPeriodSec,
+		"httpAddr":                      *httpAddr,
+		"webhookEnabled":                *webhookToken != "" || *webhookHMACSecret != "",
+		"imagePolicy":                   *imagePolicy,
+		"genericWorkloads":              *genericWorkloads,
+		"watchJobs":                     *watchJobs,
+		"watchReplicaSets":              *watchReplicaSets,
+		"updateStrategies":              *updateStrategies,
 	})
 }
 
-// newClientset returns a new kubernetes clientset
-func newClientset() *kubernetes.Clientset {
+// newRestConfig returns the in-cluster config, or the kubeconfig config outside the cluster
+func newRestConfig() *rest.Config {
 
 	// try the in-cluster config
 	if config, err := rest.InClusterConfig(); err == nil {
-		clientset, err := kubernetes.NewForConfig(config)
-		if err != nil {
-			klog.Fatal(err)
-		}
-		return clientset
+		return config
 	}
 
 	home, _ := os.UserHomeDir()
 
-	if kubeconfig == "" && home != "" {
-		kubeconfig = home + "/.kube/config"
+	if *kubeconfig == "" && home != "" {
+		*kubeconfig = home + "/.kube/config"
 	}
 
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
 
 	if err != nil {
 		klog.Fatalf("Error building kubeconfig: %s", err.Error())
 	}
 
+	return config
+}
+
+// newClientset returns a new kubernetes clientset
+func newClientset(config *rest.Config) *kubernetes.Clientset {
 	clientset, err := kubernetes.NewForConfig(config)
 
 	if err != nil {
@@ -135,15 +259,68 @@ func newClientset() *kubernetes.Clientset {
 	return clientset
 }
 
+// newDynamicClient returns a new dynamic client for custom resources
+func newDynamicClient(config *rest.Config) dynamic.Interface {
+	dynamicClient, err := dynamic.NewForConfig(config)
+
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	return dynamicClient
+}
+
 func newLogger(stopCh chan struct{}) *logger.Logger {
 	logger := logger.NewLogger()
 
-	if slackWebhook != "" {
-		logger.WithSlack(stopCh, slackWebhook, slackMsgPrefix)
+	if *slackWebhook != "" {
+		logger.WithSlack(stopCh, *slackWebhook, *slackMsgPrefix)
 	}
 	return logger
 }
 
+// healthHandler responds 200 if check succeeds, otherwise 503 with the error
+func healthHandler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+// runHTTPServer serves /metrics, /healthz, /readyz and /webhook on httpAddr until stopCh is closed
+func runHTTPServer(stopCh chan struct{}, wg *sync.WaitGroup, health *watcher.Health, notifier webhook.INotifier, logger *logger.Logger) {
+	if *httpAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", healthHandler(health.Alive))
+	mux.Handle("/readyz", healthHandler(health.Ready))
+	if *webhookToken != "" || *webhookHMACSecret != "" { // webhooks must be authenticated
+		mux.Handle("/webhook", webhook.NewHandler(notifier).WithToken(*webhookToken).WithHMACSecret(*webhookHMACSecret).WithLogger(logger))
+	}
+
+	server := &http.Server{Addr: *httpAddr, Handler: mux}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-stopCh
+		server.Shutdown(context.Background())
+	}()
+
+	go func() {
+		klog.Infof("Starting http server on %s", *httpAddr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Fatalf("Error starting http server: %s", err.Error())
+		}
+	}()
+}
+
 func main() {
 
 	sigs := make(chan os.Signal, 1)
@@ -156,22 +333,64 @@ func main() {
 	defer cancelFn()
 	var wg sync.WaitGroup
 
-	clientset := newClientset()
+	generics, err := watcher.ParseGenericWorkloads(*genericWorkloads)
+	if err != nil {
+		klog.Fatalf("Error parsing generic workloads: %s", err.Error())
+	}
+
+	strategies, err := watcher.ParseUpdateStrategies(*updateStrategies)
+	if err != nil {
+		klog.Fatalf("Error parsing update strategies: %s", err.Error())
+	}
+
+	cronJobVersion := ""
+	if *useCronjobV1 != "" { // explicit override of the API discovery
+		v1, err := strconv.ParseBool(*useCronjobV1)
+		if err != nil {
+			klog.Fatalf("Error parsing use-cronjob-v1: %s", err.Error())
+		}
+		cronJobVersion = util.CronJobV1beta1
+		if v1 {
+			cronJobVersion = util.CronJobV1
+		}
+	}
+
+	config := newRestConfig()
+	clientset := newClientset(config)
+	dynamicClient := newDynamicClient(config)
 	logger := newLogger(stopCh)
 
 	opt := &watcher.RunOptions{
-		OffDeployments:           offDeployments,
-		OffStatefulsets:          offStatefulsets,
-		OffDaemonsets:            offDaemonsets,
-		OffCronjobs:              offCronjobs,
-		ImageStringCacheTTLSec:   imageStringCacheTTLSec,
-		ImageCheckIntervalSec:    imageCheckIntervalSec,
-		ControllerWatchKey:       controllerWatchKey,
-		ControllerWatchNamespace: controllerWatchNamespace,
-		ImageDefaultPlatform:     imageDefaultPlatform,
-	}
-
-	watcher.Run(opt, ctx, clientset, stopCh, &wg, logger)
+		OffDeployments:                *offDeployments,
+		OffStatefulsets:               *offStatefulsets,
+		OffDaemonsets:                 *offDaemonsets,
+		OffCronjobs:                   *offCronjobs,
+		CronJobVersion:                cronJobVersion,
+		ImageStringCacheTTLSec:        *imageStringCacheTTLSec,
+		ImageCheckIntervalSec:         *imageCheckIntervalSec,
+		ImageResyncIntervalSec:        *imageResyncIntervalSec,
+		ImageCheckConcurrency:         *imageCheckConcurrency,
+		ImageCheckRegistryConcurrency: *imageCheckRegistryConcurrency,
+		ControllerWatchKey:            *controllerWatchKey,
+		ControllerWatchNamespace:      *controllerWatchNamespace,
+		ImageDefaultPlatform:          *imageDefaultPlatform,
+		DryRun:                        *dryRun,
+		RolloutDeadlineSec:            *rolloutDeadlineSec,
+		LeaderElect:                   *leaderElect,
+		LeaderElectLeaseName:          *leaderElectLeaseName,
+		LeaderElectLeaseNamespace:     *leaderElectLeaseNamespace,
+		LeaderElectLeaseDurationSec:   *leaderElectLeaseDurationSec,
+		LeaderElectRenewDeadlineSec:   *leaderElectRenewDeadlineSec,
+		LeaderElectRetryPeriodSec:     *leaderElectRetryPeriodSec,
+		ImagePolicy:                   *imagePolicy,
+		GenericWorkloads:              generics,
+		WatchJobs:                     *watchJobs,
+		WatchReplicaSets:              *watchReplicaSets,
+		UpdateStrategies:              strategies,
+	}
+
+	health, imageNotifier := watcher.Run(opt, ctx, clientset, dynamicClient, stopCh, &wg, logger)
+	runHTTPServer(stopCh, &wg, health, imageNotifier, logger)
 
 	// wait for a signal
 	go func() {
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/pubg/kube-image-deployer/util"
+)
+
+const namespace = "kube_image_deployer"
+
+// patch result label values
+const (
+	PatchApplied    = "applied"
+	PatchSkipped    = "skipped"
+	PatchFailed     = "failed"
+	PatchRolledBack = "rolled_back"
+	PatchDryRun     = "dry_run"
+)
+
+// webhook result label values
+const (
+	WebhookAccepted     = "accepted"
+	WebhookUnauthorized = "unauthorized"
+	WebhookInvalid      = "invalid"
+	WebhookIgnored      = "ignored"
+)
+
+var (
+	registryResolveDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "registry_resolve_duration_seconds",
+		Help:      "Time taken by registry requests to resolve image tags, per registry host. Cache hits are not observed.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"registry"})
+
+	registryResolveErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registry_resolve_errors_total",
+		Help:      "Number of failed registry requests to resolve image tags, per registry host.",
+	}, []string{"registry"})
+
+	trackedImages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tracked_images",
+		Help:      "Number of workload containers tracked, per controller.",
+	}, []string{"controller"})
+
+	pendingUpdates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_updates",
+		Help:      "Number of workload container updates held by pause, freeze, window or soak settings, per controller.",
+	}, []string{"controller"})
+
+	patches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "patches_total",
+		Help:      "Number of workload patches, per resource kind, namespace and result.",
+	}, []string{"resource", "namespace", "result"})
+
+	webhookRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_requests_total",
+		Help:      "Number of registry push webhook requests, per source and result.",
+	}, []string{"source", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(registryResolveDuration, registryResolveErrors, trackedImages, pendingUpdates, patches, webhookRequests)
+}
+
+// Handler returns the /metrics http handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRegistryResolve records the latency and the error of a registry request
+func ObserveRegistryResolve(registry string, duration time.Duration, err error) {
+	registryResolveDuration.WithLabelValues(registry).Observe(duration.Seconds())
+	if err != nil {
+		registryResolveErrors.WithLabelValues(registry).Inc()
+	}
+}
+
+// SetTrackedImages sets the number of tracked images of the controller
+func SetTrackedImages(controller string, count int) {
+	trackedImages.WithLabelValues(controller).Set(float64(count))
+}
+
+// SetPendingUpdates sets the number of held container updates of the controller
+func SetPendingUpdates(controller string, count int) {
+	pendingUpdates.WithLabelValues(controller).Set(float64(count))
+}
+
+// AddPatch counts a patch result (PatchApplied, PatchSkipped, PatchFailed, PatchRolledBack, PatchDryRun)
+func AddPatch(resource, namespace, result string) {
+	patches.WithLabelValues(resource, namespace, result).Inc()
+}
+
+// AddWebhookRequest counts a webhook request result (WebhookAccepted, WebhookUnauthorized, WebhookInvalid, WebhookIgnored)
+func AddWebhookRequest(source, result string) {
+	webhookRequests.WithLabelValues(source, result).Inc()
+}
+
+// RegisterCache exposes the hit/miss counters of the cache
+func RegisterCache(name string, cache *util.Cache) {
+	prometheus.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "cache_requests_total",
+			Help:        "Number of cache requests, per cache and result.",
+			ConstLabels: prometheus.Labels{"cache": name, "result": "hit"},
+		}, func() float64 { return float64(cache.GetHitCount()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "cache_requests_total",
+			Help:        "Number of cache requests, per cache and result.",
+			ConstLabels: prometheus.Labels{"cache": name, "result": "miss"},
+		}, func() float64 { return float64(cache.GetMissCount()) }),
+	)
+}
@@ -0,0 +1,250 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/controller"
+	"github.com/pubg/kube-image-deployer/interfaces"
+	l "github.com/pubg/kube-image-deployer/logger"
+	"github.com/pubg/kube-image-deployer/util"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const statusUpdateInterval = 10 * time.Second // status 변경을 모아서 기록하는 주기
+
+// kinds controller resource 이름별 workload kind
+var kinds = map[string]string{
+	"deployments":  "Deployment",
+	"statefulsets": "StatefulSet",
+	"daemonsets":   "DaemonSet",
+	"cronjobs":     "CronJob",
+	"jobs":         "Job",
+	"replicasets":  "ReplicaSet",
+}
+
+// Store ImagePolicy를 watch 하고, policy가 선택한 workload에 annotation을 제공한다.
+// policy 결과(resolve된 image, patch한 workload)는 status subresource에 기록한다.
+type Store struct {
+	client   dynamic.Interface
+	informer cache.SharedIndexInformer
+	watchKey string
+	logger   interfaces.ILogger
+	onChange []func()
+
+	policies      map[string]*policy // name -> policy
+	policiesMutex sync.RWMutex
+}
+
+// policy 검증된 ImagePolicy와 status 기록 상태
+type policy struct {
+	*ImagePolicy
+	selector labels.Selector
+	dirty    bool // 기록하지 않은 status 변경이 있음
+}
+
+func NewStore(client dynamic.Interface, watchKey string) *Store {
+	s := &Store{
+		client:   client,
+		watchKey: watchKey,
+		logger:   l.NewLogger(),
+		policies: make(map[string]*policy),
+	}
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	s.informer = factory.ForResource(GroupVersionResource).Informer()
+	s.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { s.setPolicy(obj) },
+		UpdateFunc: func(old interface{}, new interface{}) { s.setPolicy(new) },
+		DeleteFunc: func(obj interface{}) { s.deletePolicy(obj) },
+	})
+
+	return s
+}
+
+func (s *Store) WithLogger(logger interfaces.ILogger) *Store {
+	s.logger = logger
+	return s
+}
+
+// OnChange policy가 추가, 변경, 삭제되면 f를 호출한다. 선택된 workload를 다시 동기화하는 데 사용한다.
+func (s *Store) OnChange(f func()) *Store {
+	s.onChange = append(s.onChange, f)
+	return s
+}
+
+// Run stopCh가 닫힐 때까지 policy를 watch 하고 status를 기록한다.
+func (s *Store) Run(stopCh chan struct{}) {
+	go s.informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, s.informer.HasSynced) {
+		s.logger.Errorf("[imagepolicies] Timed out waiting for caches to sync")
+		return
+	}
+	wait.Until(s.updateStatuses, statusUpdateInterval, stopCh)
+}
+
+func (s *Store) setPolicy(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	p, err := parsePolicy(u)
+	changed := true
+
+	s.policiesMutex.Lock()
+	prev, exists := s.policies[u.GetName()]
+	if err != nil {
+		s.logger.Warningf("[imagepolicies] invalid ImagePolicy %s, err=%s\n", u.GetName(), err)
+		delete(s.policies, u.GetName())
+		changed = exists
+	} else {
+		if exists {
+			// status만 변경된 경우 workload를 다시 동기화하지 않는다.
+			changed = prev.Generation != p.Generation
+			if prev.dirty { // 기록하지 않은 status 유지
+				p.Status, p.dirty = prev.Status, true
+			}
+		}
+		s.policies[p.Name] = p
+	}
+	s.policiesMutex.Unlock()
+
+	if changed {
+		s.notifyChange()
+	}
+}
+
+func (s *Store) deletePolicy(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	s.policiesMutex.Lock()
+	delete(s.policies, u.GetName())
+	s.policiesMutex.Unlock()
+
+	s.notifyChange()
+}
+
+func (s *Store) notifyChange() {
+	for _, f := range s.onChange {
+		f()
+	}
+}
+
+// parsePolicy ImagePolicy를 변환하고 검증한다.
+func parsePolicy(u *unstructured.Unstructured) (*policy, error) {
+	p := &ImagePolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, p); err != nil {
+		return nil, err
+	}
+
+	if len(p.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("spec.containers is empty")
+	}
+	if _, _, err := util.ParseImage(p.Spec.Repository + ":" + p.Spec.Tag); err != nil {
+		return nil, fmt.Errorf("invalid spec.repository or spec.tag: %w", err)
+	}
+	selector := labels.Everything()
+	if p.Spec.Selector.Labels != nil {
+		var err error
+		if selector, err = metaV1.LabelSelectorAsSelector(p.Spec.Selector.Labels); err != nil {
+			return nil, fmt.Errorf("invalid spec.selector.labels: %w", err)
+		}
+	}
+
+	return &policy{ImagePolicy: p, selector: selector}, nil
+}
+
+// getKind workload의 kind를 반환한다. informer의 typed object는 TypeMeta가 비어있으므로 controller resource 이름으로 찾는다.
+// generic workload(unstructured)는 object의 kind를 사용한다.
+func getKind(resource string, obj interface{}) string {
+	if kind, ok := kinds[resource]; ok {
+		return kind
+	} else if t, ok := obj.(interface{ GetKind() string }); ok && t.GetKind() != "" {
+		return t.GetKind()
+	}
+	return resource
+}
+
+// matches policy가 resource의 workload를 선택하는지 확인한다. selector.kind는 kind 또는 controller resource 이름과 비교한다.
+func (p *policy) matches(resource, kind string, obj metaV1.Object) bool {
+	if p.Spec.Selector.Kind != "" && !strings.EqualFold(p.Spec.Selector.Kind, kind) && !strings.EqualFold(p.Spec.Selector.Kind, resource) {
+		return false
+	}
+	if p.Spec.Selector.Namespace != "" && p.Spec.Selector.Namespace != obj.GetNamespace() {
+		return false
+	}
+	return p.selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+func (p *policy) hasContainer(containerName string) bool {
+	for _, name := range p.Spec.Containers {
+		if name == containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// getMatchingPolicies resource의 workload를 선택하는 policy를 이름 순으로 반환한다. policiesMutex를 잡은 상태에서 호출한다.
+func (s *Store) getMatchingPolicies(resource string, obj interface{}) []*policy {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+
+	kind := getKind(resource, obj)
+	matched := make([]*policy, 0)
+	for _, p := range s.policies {
+		if p.matches(resource, kind, object) {
+			matched = append(matched, p)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Name < matched[j].Name })
+	return matched
+}
+
+// GetAnnotations workload를 선택한 policy를 annotation으로 변환하여 반환한다.
+// 같은 annotation을 여러 policy가 지정하면 이름 순으로 먼저인 policy를 사용한다.
+func (s *Store) GetAnnotations(resource string, obj interface{}) map[string]string {
+	s.policiesMutex.RLock()
+	defer s.policiesMutex.RUnlock()
+
+	annotations := make(map[string]string)
+	set := func(key, value string) {
+		if _, ok := annotations[key]; !ok && value != "" {
+			annotations[key] = value
+		}
+	}
+
+	for _, p := range s.getMatchingPolicies(resource, obj) {
+		for _, containerName := range p.Spec.Containers {
+			if _, ok := annotations[s.watchKey+"/"+containerName]; ok { // 먼저인 policy가 추적하는 container
+				continue
+			}
+			set(s.watchKey+"/"+containerName, p.Spec.Repository+":"+p.Spec.Tag)
+			set(s.watchKey+".platform/"+containerName, p.Spec.Platform)
+		}
+		set(s.watchKey+controller.SettingsAnnotation+controller.WindowSetting, p.Spec.Window)
+		set(s.watchKey+controller.SettingsAnnotation+controller.MinAgeSetting, p.Spec.MinAge)
+	}
+
+	return annotations
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/pubg/kube-image-deployer/logger"
+	appV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestStore(t *testing.T, policies ...map[string]interface{}) *Store {
+	s := &Store{watchKey: "kube-image-deployer", logger: logger.NewLogger(), policies: make(map[string]*policy)}
+	for _, p := range policies {
+		s.setPolicy(&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "kube-image-deployer.pubg.com/v1alpha1",
+			"kind":       "ImagePolicy",
+			"metadata":   map[string]interface{}{"name": p["name"]},
+			"spec":       p["spec"],
+		}})
+	}
+	return s
+}
+
+func newTestDeployment(namespace string, labels map[string]string, annotations map[string]string) *appV1.Deployment {
+	return &appV1.Deployment{ObjectMeta: metaV1.ObjectMeta{Namespace: namespace, Name: "web", Labels: labels, Annotations: annotations}}
+}
+
+func TestGetAnnotations(t *testing.T) {
+	s := newTestStore(t,
+		map[string]interface{}{"name": "a-web", "spec": map[string]interface{}{
+			"selector":   map[string]interface{}{"kind": "Deployment", "namespace": "default", "labels": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}}},
+			"containers": []interface{}{"app"},
+			"repository": "nginx",
+			"tag":        "1.25.*",
+			"window":     "Mon-Fri 02:00-05:00",
+			"minAge":     "30m",
+		}},
+		map[string]interface{}{"name": "b-all", "spec": map[string]interface{}{
+			"containers": []interface{}{"app", "sidecar"},
+			"repository": "busybox",
+			"tag":        "semver(^1.36)",
+			"platform":   "auto",
+		}},
+		map[string]interface{}{"name": "invalid", "spec": map[string]interface{}{
+			"containers": []interface{}{"app"},
+			"repository": "nginx",
+			"tag":        "",
+		}},
+	)
+
+	if len(s.policies) != 2 {
+		t.Fatalf("Expected: invalid policy ignored, Got: %d policies", len(s.policies))
+	}
+
+	annotations := s.GetAnnotations("deployments", newTestDeployment("default", map[string]string{"app": "web"}, nil))
+	expected := map[string]string{
+		"kube-image-deployer/app":              "nginx:1.25.*", // 이름 순으로 먼저인 policy
+		"kube-image-deployer/sidecar":          "busybox:semver(^1.36)",
+		"kube-image-deployer.platform/sidecar": "auto",
+		"kube-image-deployer.settings/window":  "Mon-Fri 02:00-05:00",
+		"kube-image-deployer.settings/min-age": "30m",
+	}
+	if len(annotations) != len(expected) {
+		t.Fatalf("Expected: %v, Got: %v", expected, annotations)
+	}
+	for key, value := range expected {
+		if annotations[key] != value {
+			t.Fatalf("Expected: %s=%s, Got: %v", key, value, annotations)
+		}
+	}
+
+	if annotations := s.GetAnnotations("statefulsets", newTestDeployment("default", map[string]string{"app": "web"}, nil)); annotations["kube-image-deployer/app"] != "busybox:semver(^1.36)" {
+		t.Fatalf("Expected: kind selector not matched, Got: %v", annotations)
+	}
+	if annotations := s.GetAnnotations("deployments", newTestDeployment("other", map[string]string{"app": "web"}, nil)); annotations["kube-image-deployer.settings/window"] != "" {
+		t.Fatalf("Expected: namespace selector not matched, Got: %v", annotations)
+	}
+}
+
+func TestOnImagePatched(t *testing.T) {
+	s := newTestStore(t, map[string]interface{}{"name": "web", "spec": map[string]interface{}{
+		"containers": []interface{}{"app", "sidecar"},
+		"repository": "nginx",
+		"tag":        "latest",
+	}})
+
+	s.OnImageResolved("nginx", "latest", "", "nginx@sha256:1")
+	s.OnImagePatched("deployments", newTestDeployment("default", nil, nil), "app", "nginx@sha256:1")
+	s.OnImagePatched("deployments", newTestDeployment("default", nil, map[string]string{"kube-image-deployer/sidecar": "busybox"}), "sidecar", "busybox@sha256:1") // annotation으로 지정
+
+	status := s.policies["web"].Status
+	if !s.policies["web"].dirty || status.LastResolvedImage != "nginx@sha256:1" {
+		t.Fatalf("Expected: lastResolvedImage nginx@sha256:1, Got: %+v", status)
+	}
+	if len(status.PatchedWorkloads) != 1 || status.PatchedWorkloads[0].Kind != "Deployment" || status.PatchedWorkloads[0].Container != "app" {
+		t.Fatalf("Expected: Deployment default/web app patched, Got: %+v", status.PatchedWorkloads)
+	}
+}
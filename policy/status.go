@@ -0,0 +1,128 @@
+package policy
+
+import (
+	"context"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/util"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// maxPatchedWorkloads status.patchedWorkloads에 기록하는 최대 workload container 수
+const maxPatchedWorkloads = 50
+
+// OnImageResolved repository, tag가 일치하는 policy의 status.lastResolvedImage를 기록한다.
+// platform이 auto인 policy는 workload마다 platform이 다를 수 있으므로 마지막으로 resolve된 image를 기록한다.
+func (s *Store) OnImageResolved(url, tag, platformString, imageString string) {
+	s.policiesMutex.Lock()
+	defer s.policiesMutex.Unlock()
+
+	for _, p := range s.policies {
+		if p.Spec.Repository != url || p.Spec.Tag != tag {
+			continue
+		} else if p.Spec.Platform != platformString && p.Spec.Platform != "auto" {
+			continue
+		} else if p.Status.LastResolvedImage == imageString {
+			continue
+		}
+
+		now := metaV1.Now()
+		p.Status.LastResolvedImage = imageString
+		p.Status.LastResolvedTime = &now
+		p.dirty = true
+	}
+}
+
+// OnImagePatched policy로 추적한 container가 patch 되면 status.patchedWorkloads에 기록한다.
+// workload annotation으로 직접 지정한 container는 기록하지 않는다.
+func (s *Store) OnImagePatched(resource string, obj interface{}, containerName, imageString string) {
+	if annotations, _ := util.GetAnnotations(obj); annotations[s.watchKey+"/"+containerName] != "" {
+		return
+	}
+
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+
+	s.policiesMutex.Lock()
+	defer s.policiesMutex.Unlock()
+
+	for _, p := range s.getMatchingPolicies(resource, obj) {
+		if !p.hasContainer(containerName) {
+			continue
+		}
+
+		workload := PatchedWorkload{
+			Kind:      getKind(resource, obj),
+			Namespace: object.GetNamespace(),
+			Name:      object.GetName(),
+			Container: containerName,
+			Image:     imageString,
+			Time:      metaV1.Now(),
+		}
+
+		patched := []PatchedWorkload{workload}
+		for _, w := range p.Status.PatchedWorkloads {
+			if w.Kind == workload.Kind && w.Namespace == workload.Namespace && w.Name == workload.Name && w.Container == workload.Container {
+				continue
+			}
+			patched = append(patched, w)
+		}
+		if len(patched) > maxPatchedWorkloads {
+			patched = patched[:maxPatchedWorkloads]
+		}
+
+		p.Status.PatchedWorkloads = patched
+		p.dirty = true
+		return // 이름 순으로 먼저인 policy가 container를 추적한다.
+	}
+}
+
+// updateStatuses 변경된 status를 status subresource에 기록한다. 실패하면 다음 주기에 다시 시도한다.
+func (s *Store) updateStatuses() {
+	s.policiesMutex.Lock()
+	updates := make(map[string]ImagePolicyStatus)
+	for name, p := range s.policies {
+		if p.dirty {
+			updates[name] = p.Status // PatchedWorkloads, LastResolvedTime은 변경할 때 새로 할당하므로 복사본으로 사용할 수 있다.
+			p.dirty = false
+		}
+	}
+	s.policiesMutex.Unlock()
+
+	for name, status := range updates {
+		if err := s.updateStatus(name, status); err != nil {
+			s.logger.Errorf("[imagepolicies] updateStatus error name=%s, err=%s\n", name, err)
+			s.policiesMutex.Lock()
+			if p, ok := s.policies[name]; ok {
+				p.dirty = true
+			}
+			s.policiesMutex.Unlock()
+		}
+	}
+}
+
+func (s *Store) updateStatus(name string, status ImagePolicyStatus) error {
+	obj, exists, err := s.informer.GetStore().GetByKey(name)
+	if err != nil || !exists {
+		return err
+	}
+
+	u := obj.(*unstructured.Unstructured).DeepCopy()
+	statusObject, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(u.Object, statusObject, "status"); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = s.client.Resource(GroupVersionResource).UpdateStatus(ctx, u, metaV1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,51 @@
+package policy
+
+import (
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupVersionResource ImagePolicy custom resource. docs/yaml/crd-imagepolicy.yaml
+var GroupVersionResource = schema.GroupVersionResource{Group: "kube-image-deployer.pubg.com", Version: "v1alpha1", Resource: "imagepolicies"}
+
+// ImagePolicy workload annotation 대신 selector로 선택한 workload container의 image 추적 설정
+type ImagePolicy struct {
+	metaV1.TypeMeta   `json:",inline"`
+	metaV1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ImagePolicySpec   `json:"spec"`
+	Status ImagePolicyStatus `json:"status,omitempty"`
+}
+
+type ImagePolicySpec struct {
+	Selector   WorkloadSelector `json:"selector"`
+	Containers []string         `json:"containers"`
+	Repository string           `json:"repository"`         // ex> nginx, registry.example.com/team/app
+	Tag        string           `json:"tag"`                // exact, wildcard(1.25.*), semver(...), regex(...)
+	Platform   string           `json:"platform,omitempty"` // <watchKey>.platform/<containerName>
+	Window     string           `json:"window,omitempty"`   // <watchKey>.settings/window
+	MinAge     string           `json:"minAge,omitempty"`   // <watchKey>.settings/min-age
+}
+
+// WorkloadSelector 비어있는 필드는 모든 workload와 일치한다.
+type WorkloadSelector struct {
+	Kind      string                `json:"kind,omitempty"` // Deployment, StatefulSet, DaemonSet, CronJob or the kind of a generic workload
+	Namespace string                `json:"namespace,omitempty"`
+	Labels    *metaV1.LabelSelector `json:"labels,omitempty"`
+}
+
+type ImagePolicyStatus struct {
+	LastResolvedImage string            `json:"lastResolvedImage,omitempty"`
+	LastResolvedTime  *metaV1.Time      `json:"lastResolvedTime,omitempty"`
+	PatchedWorkloads  []PatchedWorkload `json:"patchedWorkloads,omitempty"` // 최근 patch 순
+}
+
+// PatchedWorkload policy로 patch한 workload container의 마지막 patch
+type PatchedWorkload struct {
+	Kind      string      `json:"kind"`
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	Container string      `json:"container"`
+	Image     string      `json:"image"`
+	Time      metaV1.Time `json:"time"`
+}
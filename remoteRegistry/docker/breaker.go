@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pubg/kube-image-deployer/interfaces"
+	"github.com/pubg/kube-image-deployer/util"
+)
+
+const (
+	breakerFailureThreshold = 3                // 연속 실패가 이 횟수 이상이면 breaker를 연다.
+	breakerMinBackoff       = 10 * time.Second // 처음 열릴 때의 backoff
+	breakerMaxBackoff       = 10 * time.Minute // half-open probe가 실패할 때마다 2배씩 증가하는 backoff의 최대값
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breaker struct {
+	state     breakerState
+	failures  int
+	backoff   time.Duration
+	openUntil time.Time
+}
+
+// circuitBreakers registry host별 circuit breaker
+// breaker가 열린 동안에는 registry를 호출하지 않고, backoff가 지나면 요청 1개만 half-open probe로 통과시킨다.
+// probe가 성공하면 닫히고, 실패하면 backoff를 2배로 늘려 다시 열린다.
+type circuitBreakers struct {
+	breakers map[string]*breaker
+	mutex    sync.Mutex
+	logger   interfaces.ILogger
+}
+
+func newCircuitBreakers(logger interfaces.ILogger) *circuitBreakers {
+	return &circuitBreakers{
+		breakers: make(map[string]*breaker),
+		mutex:    sync.Mutex{},
+		logger:   logger,
+	}
+}
+
+// allow host에 요청을 보내도 되는지 확인한다. 열린 breaker의 backoff가 지났으면 half-open으로 전환하고 probe를 허용한다.
+func (c *circuitBreakers) allow(host string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok {
+		return true
+	}
+
+	switch b.state {
+	case breakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		c.logger.Infof("registry circuit breaker half-open host=%s", host)
+		return true
+	case breakerHalfOpen: // probe 진행중
+		return false
+	default:
+		return true
+	}
+}
+
+// report host 요청 결과를 기록한다. registry 장애로 볼 수 없는 error(not found, 4xx)는 성공으로 취급한다.
+func (c *circuitBreakers) report(host string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok {
+		b = &breaker{}
+		c.breakers[host] = b
+	}
+
+	if !isRegistryFailure(err) {
+		if b.state != breakerClosed {
+			c.logger.Warningf("registry circuit breaker closed host=%s", host)
+		}
+		delete(c.breakers, host)
+		return
+	}
+
+	b.failures++
+
+	switch b.state {
+	case breakerHalfOpen:
+		b.backoff *= 2
+		if b.backoff > breakerMaxBackoff {
+			b.backoff = breakerMaxBackoff
+		}
+		b.state = breakerOpen
+		b.openUntil = time.Now().Add(b.backoff)
+		c.logger.Infof("registry circuit breaker probe failed host=%s, backoff=%s, err=%s", host, b.backoff, err)
+	case breakerClosed:
+		if b.failures >= breakerFailureThreshold {
+			b.backoff = breakerMinBackoff
+			b.state = breakerOpen
+			b.openUntil = time.Now().Add(b.backoff)
+			c.logger.Warningf("registry circuit breaker opened host=%s, failures=%d, err=%s", host, b.failures, err)
+		}
+	}
+}
+
+// isRegistryFailure registry 자체의 장애인지 확인한다. network error, 5xx, 429는 장애로 본다.
+func isRegistryFailure(err error) bool {
+	if err == nil || errors.Is(err, util.ErrNotFound) {
+		return false
+	}
+
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return transportErr.StatusCode >= http.StatusInternalServerError || transportErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return true
+}
@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pubg/kube-image-deployer/logger"
+	"github.com/pubg/kube-image-deployer/util"
+)
+
+func TestCircuitBreakerOpenAndClose(t *testing.T) {
+	breakers := newCircuitBreakers(logger.NewLogger())
+	host := "registry.internal:5000"
+	errDown := fmt.Errorf("dial tcp: connection refused")
+
+	for i := 0; i < breakerFailureThreshold; i++ {
+		if !breakers.allow(host) {
+			t.Fatalf("Expected: closed before %d failures", breakerFailureThreshold)
+		}
+		breakers.report(host, errDown)
+	}
+
+	if breakers.allow(host) {
+		t.Fatalf("Expected: open after %d failures", breakerFailureThreshold)
+	}
+
+	breakers.breakers[host].openUntil = time.Now().Add(-time.Second)
+
+	if !breakers.allow(host) {
+		t.Fatalf("Expected: half-open probe allowed")
+	}
+
+	if breakers.allow(host) {
+		t.Fatalf("Expected: only one half-open probe")
+	}
+
+	breakers.report(host, errDown) // probe 실패
+
+	if b := breakers.breakers[host]; b.state != breakerOpen || b.backoff != breakerMinBackoff*2 {
+		t.Fatalf("Expected: reopened with doubled backoff, Got: %+v", b)
+	}
+
+	breakers.breakers[host].openUntil = time.Now().Add(-time.Second)
+	breakers.allow(host)
+	breakers.report(host, nil) // probe 성공
+
+	if _, ok := breakers.breakers[host]; ok || !breakers.allow(host) {
+		t.Fatalf("Expected: closed after successful probe")
+	}
+}
+
+func TestIsRegistryFailure(t *testing.T) {
+	if isRegistryFailure(util.ErrNotFound) {
+		t.Fatalf("Expected: not found is not a registry failure")
+	}
+
+	if isRegistryFailure(&transport.Error{StatusCode: http.StatusNotFound}) {
+		t.Fatalf("Expected: 404 is not a registry failure")
+	}
+
+	if !isRegistryFailure(&transport.Error{StatusCode: http.StatusServiceUnavailable}) {
+		t.Fatalf("Expected: 503 is a registry failure")
+	}
+
+	if !isRegistryFailure(fmt.Errorf("dial tcp: i/o timeout")) {
+		t.Fatalf("Expected: network error is a registry failure")
+	}
+}
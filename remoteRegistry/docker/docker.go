@@ -1,8 +1,12 @@
 package docker
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -10,23 +14,49 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/pubg/kube-image-deployer/interfaces"
 	"github.com/pubg/kube-image-deployer/logger"
+	"github.com/pubg/kube-image-deployer/metrics"
 	"github.com/pubg/kube-image-deployer/util"
 )
 
+// PlatformIndex platform 대신 사용하면 특정 platform의 manifest digest가 아닌
+// manifest list(OCI index) digest를 반환한다. node의 container runtime이 자신의 architecture를 선택한다.
+const PlatformIndex = "index"
+
+// defaultRequestTimeout registry 요청 1회의 timeout. 응답하지 않는 registry가 check를 무한히 붙잡지 않도록 한다.
+const defaultRequestTimeout = 30 * time.Second
+
 type RemoteRegistryDocker struct {
 	imageAuthMap    map[string]authn.Authenticator
 	defaultPlatform *v1.Platform
 	cache           *util.Cache
 	logger          interfaces.ILogger
+	transport       *rateLimitTransport
+	breakers        *circuitBreakers
+	requestTimeout  time.Duration
+
+	platformDigests      map[string]platformDigest
+	platformDigestsMutex sync.RWMutex
+}
+
+// platformDigest manifest list(index) digest와 그 중 platform에 해당하는 manifest digest
+// index digest가 바뀌지 않았다면 platform manifest digest도 바뀌지 않으므로 GET 없이 재사용한다.
+type platformDigest struct {
+	indexDigest    string
+	manifestDigest string
 }
 
 // NewRemoteRegistry returns a new RemoteRegistryDocker
 func NewRemoteRegistry() *RemoteRegistryDocker {
 	d := &RemoteRegistryDocker{
-		imageAuthMap:    make(map[string]authn.Authenticator),
-		cache:           util.NewCache(60),
-		defaultPlatform: &v1.Platform{OS: "linux", Architecture: "amd64"},
-		logger:          logger.NewLogger(),
+		imageAuthMap:         make(map[string]authn.Authenticator),
+		cache:                util.NewCache(60).WithErrorTTL(0),
+		defaultPlatform:      &v1.Platform{OS: "linux", Architecture: "amd64"},
+		logger:               logger.NewLogger(),
+		transport:            newRateLimitTransport(remote.DefaultTransport),
+		breakers:             newCircuitBreakers(logger.NewLogger()),
+		requestTimeout:       defaultRequestTimeout,
+		platformDigests:      make(map[string]platformDigest),
+		platformDigestsMutex: sync.RWMutex{},
 	}
 
 	return d
@@ -34,6 +64,7 @@ func NewRemoteRegistry() *RemoteRegistryDocker {
 
 func (d *RemoteRegistryDocker) WithLogger(logger interfaces.ILogger) *RemoteRegistryDocker {
 	d.logger = logger
+	d.breakers.logger = logger
 	return d
 }
 
@@ -42,8 +73,15 @@ func (d *RemoteRegistryDocker) WithImageAuthMap(imageAuthMap map[string]authn.Au
 	return d
 }
 
+// GetCache returns the image string cache
+func (d *RemoteRegistryDocker) GetCache() *util.Cache {
+	return d.cache
+}
+
+// WithCache error 결과는 cache 하지 않는다. registry 장애시에는 circuit breaker가 요청을 차단하며,
+// breaker가 닫힌 뒤 cache된 error가 TTL 동안 남아있지 않도록 한다.
 func (d *RemoteRegistryDocker) WithCache(cacheTTL uint) *RemoteRegistryDocker {
-	d.cache = util.NewCache(cacheTTL)
+	d.cache = util.NewCache(cacheTTL).WithErrorTTL(0)
 	return d
 }
 
@@ -60,9 +98,21 @@ func (d *RemoteRegistryDocker) WithDefaultPlatform(platformString string) *Remot
 // GetImage returns a docker image digest hash from url:tag
 func (d *RemoteRegistryDocker) GetImageString(url, tag, platformString string) (string, error) {
 
-	if strings.Contains(tag, "*") {
+	if constraint, ok := util.ParseSemverTag(tag); ok {
+		// semver(<constraint>)인 경우 전체 tag에서 constraint를 만족하는 가장 높은 semver tag를 찾아 반환한다.
+		return d.getImageHighestVersionTag(url, tag, platformString, func(tags []string) (string, error) {
+			return util.GetHighestSemverWithConstraint(tags, constraint)
+		})
+	} else if pattern, sortKind, ok := util.ParseRegexTag(tag); ok {
+		// regex(<pattern>,<sortKind>)인 경우 전체 tag에서 order group이 가장 큰 tag를 찾아 반환한다.
+		return d.getImageHighestVersionTag(url, tag, platformString, func(tags []string) (string, error) {
+			return util.GetHighestTagWithRegex(tags, pattern, sortKind)
+		})
+	} else if strings.Contains(tag, "*") {
 		// *을 포함하는 경우 전체 tag에서 가장 높은 tag를 찾아 반환한다.
-		return d.getImageHighestVersionTag(url, tag, platformString)
+		return d.getImageHighestVersionTag(url, tag, platformString, func(tags []string) (string, error) {
+			return util.GetHighestVersionWithFilter(tags, tag)
+		})
 	} else {
 		// 단일 tag인 경우 가장 최신 sha256 digest를 반환한다. digest의 경우 platform이 필요하다.
 		return d.getImageDigestHash(url, tag, platformString)
@@ -94,9 +144,52 @@ func (d *RemoteRegistryDocker) getRemoteOptions(url string) []remote.Option {
 		options = append(options, remote.WithAuthFromKeychain(authn.DefaultKeychain))
 	}
 
+	options = append(options, remote.WithTransport(d.transport))
+
 	return options
 }
 
+// callRegistry registry host의 circuit breaker가 열려있으면 요청하지 않고 ErrCircuitOpen을 반환한다.
+// 요청 결과는 breaker에 기록한다. f에는 requestTimeout이 지나면 취소되는 context를 전달한다.
+func (d *RemoteRegistryDocker) callRegistry(host string, f func(ctx context.Context) error) error {
+	if !d.breakers.allow(host) {
+		return fmt.Errorf("%w: %s", util.ErrCircuitOpen, host)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.requestTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := f(ctx)
+	metrics.ObserveRegistryResolve(host, time.Since(start), err)
+	d.breakers.report(host, err)
+	return err
+}
+
+// GetRateLimitRemaining returns the last RateLimit-Remaining value reported by the registry of the url.
+// ok is false if the registry did not report it or the reported window has passed.
+func (d *RemoteRegistryDocker) GetRateLimitRemaining(url string) (int, bool) {
+	repo, err := name.NewRepository(url)
+	if err != nil {
+		return 0, false
+	}
+	return d.transport.getRemaining(repo.RegistryStr())
+}
+
+// InvalidateImageString tag가 push 되었을 때 url:tag의 digest와 url의 tag pattern 결과를 cache에서 삭제한다.
+// push된 tag가 *, semver(...), regex(...) tag의 선택 결과를 바꿀 수 있으므로 url의 pattern 결과는 모두 삭제한다.
+// tag가 비어있으면 url의 모든 cache를 삭제한다.
+func (d *RemoteRegistryDocker) InvalidateImageString(url, tag string) {
+	d.cache.DeleteFunc(func(key string) bool {
+		if strings.HasPrefix(key, url+"___") {
+			return true
+		} else if tag == "" {
+			return strings.HasPrefix(key, url+":")
+		}
+		return strings.HasPrefix(key, url+":"+tag+"___")
+	})
+}
+
 func (d *RemoteRegistryDocker) getImageDigestHash(url, tag, platformString string) (string, error) {
 
 	platform, err := d.parsePlatform(platformString)
@@ -107,44 +200,126 @@ func (d *RemoteRegistryDocker) getImageDigestHash(url, tag, platformString strin
 
 	fullUrl := fmt.Sprintf("%s:%s", url, tag)
 	options := d.getRemoteOptions(url)
-	options = append(options, remote.WithPlatform(*platform))
+	platformKey := PlatformIndex
+	if platform != nil {
+		options = append(options, remote.WithPlatform(*platform))
+		platformKey = platform.String()
+	}
 	ref, err := name.ParseReference(fullUrl)
 
 	if err != nil {
 		return "", err
 	}
 
-	hash, err := d.cache.Get(fullUrl, func() (interface{}, error) {
-		if img, err := remote.Image(ref, options...); err == nil {
-			if digest, err := img.Digest(); err == nil {
-				return digest.String(), nil
-			} else {
-				return "", err
-			}
-		} else {
-			return "", err
-		}
+	cacheKey := fullUrl + "___" + platformKey
+	hash, err := d.cache.Get(cacheKey, func() (interface{}, error) {
+		return d.resolveDigest(cacheKey, ref, platform, d.getAuthenticator(url), options)
 	})
 
 	return url + "@" + hash.(string), err
 
 }
 
-func (d *RemoteRegistryDocker) getImageHighestVersionTag(url, tag, platformString string) (string, error) {
+// resolveDigest HEAD 요청의 Docker-Content-Digest header로 digest를 확인한다. HEAD는 Docker Hub pull 횟수에 포함되지 않는다.
+// registry가 header를 반환하지 않는 경우에만 GET으로 manifest를 조회한다.
+// tag가 manifest list(index)를 가리키고 platform이 지정된 경우, index digest가 바뀐 경우에만 GET으로 platform manifest digest를 찾는다.
+func (d *RemoteRegistryDocker) resolveDigest(cacheKey string, ref name.Reference, platform *v1.Platform, auth authn.Authenticator, options []remote.Option) (string, error) {
+
+	var head *v1.Descriptor
+	var headOk bool
+	err := d.callRegistry(ref.Context().RegistryStr(), func(ctx context.Context) (err error) {
+		head, headOk, err = d.headManifest(ctx, ref, auth)
+		return err
+	})
+	if err != nil {
+		return "", err
+	} else if !headOk { // registry는 응답했지만 digest header가 없다.
+		d.logger.Infof("resolveDigest HEAD response has no digest header, fallback to GET ref=%s", ref)
+		return d.getDigest(cacheKey, ref, platform, options)
+	}
+
+	if platform == nil || !head.MediaType.IsIndex() { // index mode 이거나 단일 platform image
+		return head.Digest.String(), nil
+	}
+
+	d.platformDigestsMutex.RLock()
+	known, ok := d.platformDigests[cacheKey]
+	d.platformDigestsMutex.RUnlock()
+
+	if ok && known.indexDigest == head.Digest.String() {
+		return known.manifestDigest, nil
+	}
+
+	return d.getDigest(cacheKey, ref, platform, options)
+}
+
+// getDigest GET으로 manifest를 조회하여 digest를 반환한다.
+func (d *RemoteRegistryDocker) getDigest(cacheKey string, ref name.Reference, platform *v1.Platform, options []remote.Option) (string, error) {
+
+	var desc *remote.Descriptor
+	err := d.callRegistry(ref.Context().RegistryStr(), func(ctx context.Context) (err error) {
+		desc, err = remote.Get(ref, append(options, remote.WithContext(ctx))...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if platform == nil || !desc.MediaType.IsIndex() {
+		return desc.Digest.String(), nil
+	}
+
+	// 이미 받은 index manifest에서 platform에 해당하는 manifest digest를 찾는다. (추가 GET 없음)
+	index, err := v1.ParseIndexManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return "", err
+	}
+
+	for _, manifest := range index.Manifests {
+		if !matchPlatform(manifest.Platform, platform) {
+			continue
+		}
+
+		d.platformDigestsMutex.Lock()
+		d.platformDigests[cacheKey] = platformDigest{indexDigest: desc.Digest.String(), manifestDigest: manifest.Digest.String()}
+		d.platformDigestsMutex.Unlock()
+
+		return manifest.Digest.String(), nil
+	}
+
+	return "", fmt.Errorf("no manifest with platform %s in index %s", platform, ref)
+}
+
+// matchPlatform child manifest의 platform이 요청한 platform과 일치하는지 확인한다.
+// child에 platform이 없으면 linux/amd64로 간주하며, variant는 요청한 경우에만 비교한다.
+func matchPlatform(child *v1.Platform, platform *v1.Platform) bool {
+	p := v1.Platform{OS: "linux", Architecture: "amd64"}
+	if child != nil {
+		p = *child
+	}
+	return p.OS == platform.OS && p.Architecture == platform.Architecture && (platform.Variant == "" || p.Variant == platform.Variant)
+}
+
+// getImageHighestVersionTag 전체 tag 목록에서 selector가 선택한 tag의 digest hash를 반환한다.
+func (d *RemoteRegistryDocker) getImageHighestVersionTag(url, tag, platformString string, selector func(tags []string) (string, error)) (string, error) {
 	options := d.getRemoteOptions(url)
 	repo, err := name.NewRepository(url)
 	if nil != err {
 		return "", err
 	}
 
-	cacheKey := url + "___" + tag
+	cacheKey := url + "___" + tag + "___" + platformString
 	image, err := d.cache.Get(cacheKey, func() (interface{}, error) {
-		tags, err := remote.List(repo, options...)
+		var tags []string
+		err := d.callRegistry(repo.RegistryStr(), func(ctx context.Context) (err error) {
+			tags, err = remote.List(repo, append(options, remote.WithContext(ctx))...)
+			return err
+		})
 		if nil != err {
 			return "", err
 		}
 
-		t, err := util.GetHighestVersionWithFilter(tags, tag)
+		t, err := selector(tags)
 		if nil != err {
 			return "", err
 		}
@@ -159,10 +334,13 @@ func (d *RemoteRegistryDocker) getImageHighestVersionTag(url, tag, platformStrin
 	return image.(string), nil
 }
 
+// parsePlatform platformString을 v1.Platform으로 변환한다. PlatformIndex인 경우 nil을 반환한다.
 func (d *RemoteRegistryDocker) parsePlatform(platformString string) (*v1.Platform, error) {
 
 	if platformString == "" {
 		return d.defaultPlatform, nil
+	} else if platformString == PlatformIndex {
+		return nil, nil
 	}
 
 	arr := strings.Split(platformString, "/")
@@ -16,3 +16,33 @@ func TestGetImageStringAsterisk(t *testing.T) {
 		t.Logf("success: %s", s)
 	}
 }
+
+func TestGetImageStringSemver(t *testing.T) {
+	r := NewRemoteRegistry()
+
+	if s, err := r.GetImageString("busybox", "semver(~1.34)", "linux/amd64"); err != nil {
+		t.Fatalf("err: %v", err)
+	} else if !strings.HasPrefix(s, "busybox@sha256:") {
+		t.Fatalf("no digest: %s", s)
+	} else {
+		t.Logf("success: %s", s)
+	}
+}
+
+func TestGetImageStringIndex(t *testing.T) {
+	r := NewRemoteRegistry()
+
+	index, err := r.GetImageString("busybox", "1.34.1", PlatformIndex)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	amd64, err := r.GetImageString("busybox", "1.34.1", "linux/amd64")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if !strings.HasPrefix(index, "busybox@sha256:") || index == amd64 {
+		t.Fatalf("index digest expected: %s, %s", index, amd64)
+	}
+}
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// manifestMediaTypes HEAD 요청의 Accept header. remote.Head와 동일하게 image manifest와 manifest list(index)를 모두 허용한다.
+var manifestMediaTypes = []string{
+	string(types.DockerManifestSchema2),
+	string(types.OCIManifestSchema1),
+	string(types.DockerManifestList),
+	string(types.OCIImageIndex),
+}
+
+// headManifest HEAD 요청으로 manifest의 media type과 digest를 조회한다.
+// registry가 Content-Type 또는 Docker-Content-Digest header를 반환하지 않으면 ok가 false이며, GET으로 조회해야 한다.
+// auth가 nil이면 DefaultKeychain에서 인증 정보를 찾는다.
+func (d *RemoteRegistryDocker) headManifest(ctx context.Context, ref name.Reference, auth authn.Authenticator) (desc *v1.Descriptor, ok bool, err error) {
+
+	repo := ref.Context()
+	if auth == nil {
+		if auth, err = authn.DefaultKeychain.Resolve(repo); err != nil {
+			return nil, false, err
+		}
+	}
+
+	rt, err := transport.NewWithContext(ctx, repo.Registry, auth, d.transport, []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, false, err
+	}
+
+	u := url.URL{
+		Scheme: repo.Registry.Scheme(),
+		Host:   repo.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/manifests/%s", repo.RepositoryStr(), ref.Identifier()),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ","))
+
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return nil, false, err
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if mediaType == "" || digest == "" {
+		return nil, false, nil
+	}
+
+	hash, err := v1.NewHash(digest)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &v1.Descriptor{Digest: hash, MediaType: types.MediaType(mediaType), Size: resp.ContentLength}, true, nil
+}
@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const testManifest = `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},"layers":[]}`
+
+// newTestRegistry manifest HEAD 응답에 Docker-Content-Digest header를 포함할지 선택할 수 있는 registry
+func newTestRegistry(t *testing.T, digestHeader bool, heads, gets *int32) string {
+	digest, _, err := v1.SHA256(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.Header().Set("Content-Type", string(types.DockerManifestSchema2))
+		switch r.Method {
+		case http.MethodHead:
+			atomic.AddInt32(heads, 1)
+			if digestHeader {
+				w.Header().Set("Docker-Content-Digest", digest.String())
+			}
+		case http.MethodGet:
+			atomic.AddInt32(gets, 1)
+			w.Write([]byte(testManifest))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://") + "/app"
+}
+
+func TestGetImageStringHead(t *testing.T) {
+	var heads, gets int32
+	url := newTestRegistry(t, true, &heads, &gets)
+
+	s, err := NewRemoteRegistry().GetImageString(url, "v1", "linux/amd64")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	} else if !strings.HasPrefix(s, url+"@sha256:") {
+		t.Fatalf("no digest: %s", s)
+	}
+
+	if heads != 1 || gets != 0 {
+		t.Fatalf("Expected: 1 HEAD, 0 GET, Got: %d HEAD, %d GET", heads, gets)
+	}
+}
+
+func TestGetImageStringHeadWithoutDigestHeader(t *testing.T) {
+	var heads, gets int32
+	url := newTestRegistry(t, false, &heads, &gets)
+
+	r := NewRemoteRegistry()
+	s, err := r.GetImageString(url, "v1", "linux/amd64")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	} else if !strings.HasPrefix(s, url+"@sha256:") {
+		t.Fatalf("no digest: %s", s)
+	}
+
+	if heads != 1 || gets != 1 {
+		t.Fatalf("Expected: 1 HEAD, 1 GET, Got: %d HEAD, %d GET", heads, gets)
+	}
+
+	// header가 없는 것은 registry 장애가 아니다.
+	if !r.breakers.allow(strings.Split(url, "/")[0]) {
+		t.Fatalf("Expected: breaker closed")
+	}
+}
+
+// 응답하지 않는 registry는 requestTimeout이 지나면 error를 반환해야 한다.
+func TestGetImageStringTimeout(t *testing.T) {
+	blockCh := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blockCh
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(blockCh) })
+
+	r := NewRemoteRegistry()
+	r.requestTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	if _, err := r.GetImageString(strings.TrimPrefix(server.URL, "http://")+"/app", "v1", "linux/amd64"); err == nil {
+		t.Fatalf("Expected: timeout error")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected: returned after requestTimeout, Got: %s", elapsed)
+	}
+}
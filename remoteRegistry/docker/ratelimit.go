@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitWindow RateLimit-Remaining header에 window(w=)가 없는 경우 사용한다.
+const defaultRateLimitWindow = time.Hour
+
+type rateLimit struct {
+	remaining int
+	window    time.Duration
+	time      time.Time
+}
+
+// rateLimitTransport registry 응답의 RateLimit-Remaining header를 host별로 기록하는 http.RoundTripper
+// ex> RateLimit-Remaining: 76;w=21600 (Docker Hub)
+type rateLimitTransport struct {
+	inner      http.RoundTripper
+	rateLimits map[string]rateLimit
+	mutex      sync.RWMutex
+}
+
+func newRateLimitTransport(inner http.RoundTripper) *rateLimitTransport {
+	return &rateLimitTransport{
+		inner:      inner,
+		rateLimits: make(map[string]rateLimit),
+		mutex:      sync.RWMutex{},
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if limit, ok := parseRateLimitRemaining(resp.Header.Get("RateLimit-Remaining")); ok {
+		t.mutex.Lock()
+		t.rateLimits[req.URL.Host] = limit
+		t.mutex.Unlock()
+	}
+
+	return resp, err
+}
+
+// getRemaining host의 마지막 RateLimit-Remaining 값을 반환한다. 기록이 없거나 window가 지난 경우 ok=false
+func (t *rateLimitTransport) getRemaining(host string) (int, bool) {
+	t.mutex.RLock()
+	limit, ok := t.rateLimits[host]
+	t.mutex.RUnlock()
+
+	if !ok || time.Since(limit.time) > limit.window {
+		return 0, false
+	}
+
+	return limit.remaining, true
+}
+
+func parseRateLimitRemaining(value string) (rateLimit, bool) {
+	if value == "" {
+		return rateLimit{}, false
+	}
+
+	arr := strings.Split(value, ";")
+	remaining, err := strconv.Atoi(strings.TrimSpace(arr[0]))
+	if err != nil {
+		return rateLimit{}, false
+	}
+
+	limit := rateLimit{remaining: remaining, window: defaultRateLimitWindow, time: time.Now()}
+
+	for _, param := range arr[1:] {
+		if w := strings.TrimPrefix(strings.TrimSpace(param), "w="); w != strings.TrimSpace(param) {
+			if sec, err := strconv.Atoi(w); err == nil && sec > 0 {
+				limit.window = time.Duration(sec) * time.Second
+			}
+		}
+	}
+
+	return limit, true
+}
@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitRemaining(t *testing.T) {
+	if limit, ok := parseRateLimitRemaining("76;w=21600"); !ok || limit.remaining != 76 || limit.window != 21600*time.Second {
+		t.Fatalf("Expected: 76, 6h, Got: %+v", limit)
+	}
+
+	if limit, ok := parseRateLimitRemaining("0"); !ok || limit.remaining != 0 || limit.window != defaultRateLimitWindow {
+		t.Fatalf("Expected: 0, default window, Got: %+v", limit)
+	}
+
+	if _, ok := parseRateLimitRemaining(""); ok {
+		t.Fatalf("Expected: not ok")
+	}
+}
+
+func TestRateLimitTransportGetRemaining(t *testing.T) {
+	transport := newRateLimitTransport(nil)
+	transport.rateLimits["index.docker.io"] = rateLimit{remaining: 3, window: time.Hour, time: time.Now()}
+	transport.rateLimits["expired.io"] = rateLimit{remaining: 0, window: time.Second, time: time.Now().Add(-time.Minute)}
+
+	if remaining, ok := transport.getRemaining("index.docker.io"); !ok || remaining != 3 {
+		t.Fatalf("Expected: 3, Got: %d", remaining)
+	}
+
+	if _, ok := transport.getRemaining("expired.io"); ok {
+		t.Fatalf("Expected: expired")
+	}
+}
@@ -7,11 +7,13 @@ import (
 )
 
 type Cache struct {
-	TTL uint
+	TTL      uint
+	ErrorTTL uint // error 결과의 TTL. 기본값은 TTL
 
 	cache                  map[string]*cacheResult
 	mutex                  *sync.Mutex
 	cacheGetterCalledCount uint32
+	cacheHitCount          uint32
 }
 
 type cacheResult struct {
@@ -24,28 +26,51 @@ type cacheResult struct {
 func NewCache(ttlSeconds uint) *Cache {
 	return &Cache{
 		TTL:                    ttlSeconds,
+		ErrorTTL:               ttlSeconds,
 		cache:                  make(map[string]*cacheResult),
 		mutex:                  &sync.Mutex{},
 		cacheGetterCalledCount: 0,
 	}
 }
 
+// WithErrorTTL error 결과를 ttlSeconds 동안만 cache 한다. 0이면 error는 cache 하지 않는다.
+func (c *Cache) WithErrorTTL(ttlSeconds uint) *Cache {
+	c.ErrorTTL = ttlSeconds
+	return c
+}
+
+// GetHitCount returns the number of Get calls served from the cache
+func (c *Cache) GetHitCount() uint32 {
+	return atomic.LoadUint32(&c.cacheHitCount)
+}
+
+// GetMissCount returns the number of Get calls which called the getter
+func (c *Cache) GetMissCount() uint32 {
+	return atomic.LoadUint32(&c.cacheGetterCalledCount)
+}
+
 func (c *Cache) Get(key string, getter func() (interface{}, error)) (interface{}, error) {
 	c.mutex.Lock()
 	cache, ok := c.cache[key]
 	c.mutex.Unlock()
 
-	if ok && time.Since(cache.time) < time.Duration(c.TTL)*time.Second {
+	if ok {
 		cache.mutex.Lock()
-		value, err := cache.value, cache.err
-		cache.mutex.Unlock()
-		return value, err
-	}
 
-	atomic.AddUint32(&c.cacheGetterCalledCount, 1)
+		ttl := c.TTL
+		if cache.err != nil {
+			ttl = c.ErrorTTL
+		}
+
+		if time.Since(cache.time) < time.Duration(ttl)*time.Second {
+			value, err := cache.value, cache.err
+			cache.mutex.Unlock()
+			atomic.AddUint32(&c.cacheHitCount, 1)
+			return value, err
+		}
+
+		atomic.AddUint32(&c.cacheGetterCalledCount, 1)
 
-	if ok {
-		cache.mutex.Lock()
 		value, err := getter() // getter 획득동안 lock 유지
 		cache.value = value
 		cache.err = err
@@ -53,6 +78,8 @@ func (c *Cache) Get(key string, getter func() (interface{}, error)) (interface{}
 		cache.mutex.Unlock()
 		return value, err
 	} else {
+		atomic.AddUint32(&c.cacheGetterCalledCount, 1)
+
 		cache := &cacheResult{
 			value: nil,
 			err:   nil,
@@ -76,3 +103,18 @@ func (c *Cache) Get(key string, getter func() (interface{}, error)) (interface{}
 	}
 
 }
+
+// DeleteFunc match가 true를 반환하는 key를 cache에서 삭제하고 삭제한 개수를 반환한다.
+func (c *Cache) DeleteFunc(match func(key string) bool) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	deleted := 0
+	for key := range c.cache {
+		if match(key) {
+			delete(c.cache, key)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -42,4 +42,42 @@ func TestCacheRaceKey(t *testing.T) {
 		t.Fatalf("TestCacheRaceKey getterCalledCount: %d", cache.cacheGetterCalledCount)
 	}
 
+	if cache.GetHitCount() != 1 || cache.GetMissCount() != 1 {
+		t.Fatalf("TestCacheRaceKey hit: %d, miss: %d", cache.GetHitCount(), cache.GetMissCount())
+	}
+
+}
+
+// ErrorTTL이 0이면 error 결과는 cache 하지 않고, 성공 결과는 TTL 동안 cache 해야 한다.
+func TestCacheErrorTTL(t *testing.T) {
+
+	cache := NewCache(60).WithErrorTTL(0)
+	fail := true
+
+	getter := func() (interface{}, error) {
+		if fail {
+			return "", fmt.Errorf("registry down")
+		}
+		return "bbb", nil
+	}
+
+	if _, err := cache.Get("aaa", getter); err == nil {
+		t.Fatalf("TestCacheErrorTTL expected error")
+	}
+
+	fail = false
+
+	if r, err := cache.Get("aaa", getter); r != "bbb" || err != nil {
+		t.Fatalf("TestCacheErrorTTL error cached: %v, %v", r, err)
+	}
+
+	fail = true
+
+	if r, err := cache.Get("aaa", getter); r != "bbb" || err != nil {
+		t.Fatalf("TestCacheErrorTTL value not cached: %v, %v", r, err)
+	}
+
+	if cache.cacheGetterCalledCount != 2 {
+		t.Fatalf("TestCacheErrorTTL getterCalledCount: %d", cache.cacheGetterCalledCount)
+	}
 }
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"fmt"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+)
+
+// CronJob API versions
+const (
+	CronJobV1      = "v1"      // batch/v1, Kubernetes 1.21+
+	CronJobV1beta1 = "v1beta1" // batch/v1beta1, removed in Kubernetes 1.25
+)
+
+// DetectCronJobVersion returns batch/v1 if the API server serves CronJobs in batch/v1, otherwise batch/v1beta1.
+// batch/v1 exists in every version for Jobs, so the cronjobs resource is checked.
+func DetectCronJobVersion(client discovery.DiscoveryInterface) (string, error) {
+	resources, err := client.ServerResourcesForGroupVersion("batch/v1")
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return "", fmt.Errorf("discovering batch/v1 resources: %w", err)
+	}
+
+	if resources != nil {
+		for _, resource := range resources.APIResources {
+			if resource.Name == "cronjobs" {
+				return CronJobV1, nil
+			}
+		}
+	}
+
+	return CronJobV1beta1, nil
+}
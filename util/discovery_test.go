@@ -0,0 +1,23 @@
+package util
+
+import (
+	"testing"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeDiscovery "k8s.io/client-go/discovery/fake"
+	clientTesting "k8s.io/client-go/testing"
+)
+
+func TestDetectCronJobVersion(t *testing.T) {
+	batchV1 := &metaV1.APIResourceList{GroupVersion: "batch/v1", APIResources: []metaV1.APIResource{{Name: "jobs"}}}
+	client := &fakeDiscovery.FakeDiscovery{Fake: &clientTesting.Fake{Resources: []*metaV1.APIResourceList{batchV1}}}
+
+	if version, err := DetectCronJobVersion(client); err != nil || version != CronJobV1beta1 {
+		t.Errorf("Expected: %s, Got: %s, %v", CronJobV1beta1, version, err)
+	}
+
+	batchV1.APIResources = append(batchV1.APIResources, metaV1.APIResource{Name: "cronjobs"})
+	if version, err := DetectCronJobVersion(client); err != nil || version != CronJobV1 {
+		t.Errorf("Expected: %s, Got: %s, %v", CronJobV1, version, err)
+	}
+}
@@ -0,0 +1,6 @@
+package util
+
+import "errors"
+
+// ErrCircuitOpen registry host의 circuit breaker가 열려 있어 요청하지 않은 경우 반환된다.
+var ErrCircuitOpen = errors.New("registry circuit breaker is open")
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// GenericWorkload dynamic client로 조회한 임의 kind의 workload. TemplatePath의 PodTemplateSpec을 사용한다.
+// CRD는 strategic merge patch를 지원하지 않으므로 JSON patch로 변경한다.
+type GenericWorkload struct {
+	*unstructured.Unstructured
+	TemplatePath []string // pod template의 위치. ex> ["spec", "template"]
+}
+
+// jsonPatchOperation RFC 6902 JSON patch operation
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// ParseTemplatePath ".spec.template" 또는 "{.spec.template}" 형식의 JSONPath를 field 목록으로 변환한다.
+// field 이름으로만 구성된 경로를 지원하며, filter나 배열 index는 지원하지 않는다.
+func ParseTemplatePath(path string) ([]string, error) {
+	path = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(path), "{"), "}")
+	if !strings.HasPrefix(path, ".") {
+		return nil, fmt.Errorf("invalid template path %q: must start with '.'", path)
+	}
+
+	fields := strings.Split(path[1:], ".")
+	for _, field := range fields {
+		if field == "" || strings.ContainsAny(field, "[]*?@()'\" ") {
+			return nil, fmt.Errorf("invalid template path %q: only field names are supported", path)
+		}
+	}
+	return fields, nil
+}
+
+// GetPodTemplate TemplatePath의 PodTemplateSpec을 반환한다.
+func (w *GenericWorkload) GetPodTemplate() (coreV1.PodTemplateSpec, error) {
+	template := coreV1.PodTemplateSpec{}
+
+	m, found, err := unstructured.NestedMap(w.Object, w.TemplatePath...)
+	if err != nil {
+		return template, err
+	} else if !found {
+		return template, fmt.Errorf("pod template .%s not found", strings.Join(w.TemplatePath, "."))
+	}
+
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(m, &template)
+	return template, err
+}
+
+// getImageJSONPatch containers, initContainers의 image와 annotations를 변경하는 JSON patch를 생성한다.
+// container 순서가 바뀐 경우 patch가 실패하도록 index의 container 이름을 test 한다. 값이 빈 문자열인 annotation은 삭제한다.
+func (w *GenericWorkload) getImageJSONPatch(containers, initContainers []Container, annotations map[string]string) ([]byte, error) {
+	operations := make([]jsonPatchOperation, 0)
+
+	for _, field := range []string{"containers", "initContainers"} {
+		patchContainers := containers
+		if field == "initContainers" {
+			patchContainers = initContainers
+		}
+		if len(patchContainers) == 0 {
+			continue
+		}
+
+		fields := append(append([]string{}, w.TemplatePath...), "spec", field)
+		current, _, err := unstructured.NestedSlice(w.Object, fields...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, container := range patchContainers {
+			index := -1
+			for i, c := range current {
+				if m, ok := c.(map[string]interface{}); ok && m["name"] == container.Name {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				return nil, fmt.Errorf("%s %s not found", field, container.Name)
+			}
+
+			path := getJSONPointer(append(fields, strconv.Itoa(index)))
+			operations = append(operations,
+				jsonPatchOperation{Op: "test", Path: path + "/name", Value: container.Name},
+				jsonPatchOperation{Op: "replace", Path: path + "/image", Value: container.Image},
+			)
+		}
+	}
+
+	current := w.GetAnnotations()
+	added := make(map[string]string)
+	for key, value := range annotations {
+		path := getJSONPointer([]string{"metadata", "annotations", key})
+		if _, exists := current[key]; value == "" && exists { // 빈 문자열은 삭제
+			operations = append(operations, jsonPatchOperation{Op: "remove", Path: path})
+		} else if value != "" && current != nil {
+			operations = append(operations, jsonPatchOperation{Op: "add", Path: path, Value: value})
+		} else if value != "" {
+			added[key] = value
+		}
+	}
+	if len(added) > 0 { // annotation이 없는 workload
+		operations = append(operations, jsonPatchOperation{Op: "add", Path: "/metadata/annotations", Value: added})
+	}
+
+	return json.Marshal(operations)
+}
+
+func getJSONPointer(fields []string) string {
+	escaped := make([]string, len(fields))
+	for i, field := range fields {
+		escaped[i] = jsonPointerEscaper.Replace(field)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestGenericWorkload(annotations map[string]interface{}) *GenericWorkload {
+	metadata := map[string]interface{}{"namespace": "default", "name": "web"}
+	if annotations != nil {
+		metadata["annotations"] = annotations
+	}
+	return &GenericWorkload{
+		Unstructured: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Rollout",
+			"metadata":   metadata,
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"initContainers": []interface{}{map[string]interface{}{"name": "init", "image": "busybox:1"}},
+				"containers": []interface{}{
+					map[string]interface{}{"name": "sidecar", "image": "envoy:1"},
+					map[string]interface{}{"name": "app", "image": "nginx:1"},
+				},
+			}}},
+		}},
+		TemplatePath: []string{"spec", "template"},
+	}
+}
+
+func TestParseTemplatePath(t *testing.T) {
+	for path, expected := range map[string]string{".spec.template": "spec/template", "{.spec.template}": "spec/template", "spec.template": "", ".spec.containers[0]": "", ".spec..template": ""} {
+		fields, err := ParseTemplatePath(path)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%s Expected: error, Got: %v", path, fields)
+			}
+		} else if err != nil || getJSONPointer(fields) != "/"+expected {
+			t.Errorf("%s Expected: %s, Got: %v, err=%v", path, expected, fields, err)
+		}
+	}
+}
+
+func TestGenericWorkloadContainers(t *testing.T) {
+	w := newTestGenericWorkload(nil)
+
+	if container, err := GetContainerByName(w, "app"); err != nil || container.Image != "nginx:1" {
+		t.Errorf("Expected: nginx:1, Got: %+v, err=%v", container, err)
+	}
+	if container, err := GetInitContainerByName(w, "init"); err != nil || container.Image != "busybox:1" {
+		t.Errorf("Expected: busybox:1, Got: %+v, err=%v", container, err)
+	}
+}
+
+func TestGenericWorkloadJSONPatch(t *testing.T) {
+	containers := []Container{{Name: "app", Image: "nginx@sha256:2"}}
+	initContainers := []Container{{Name: "init", Image: "busybox@sha256:2"}}
+
+	patch, err := GetImageStrategicPatchJson(newTestGenericWorkload(nil), containers, initContainers, map[string]string{"kube-image-deployer.history/app": "[]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"op":"test","path":"/spec/template/spec/containers/1/name","value":"app"},{"op":"replace","path":"/spec/template/spec/containers/1/image","value":"nginx@sha256:2"},` +
+		`{"op":"test","path":"/spec/template/spec/initContainers/0/name","value":"init"},{"op":"replace","path":"/spec/template/spec/initContainers/0/image","value":"busybox@sha256:2"},` +
+		`{"op":"add","path":"/metadata/annotations","value":{"kube-image-deployer.history/app":"[]"}}]`
+	if string(patch) != expected {
+		t.Errorf("Expected: %s, Got: %s", expected, patch)
+	}
+
+	patch, err = GetImageStrategicPatchJson(newTestGenericWorkload(map[string]interface{}{"a": "b"}), nil, nil, map[string]string{"kube-image-deployer.history/app": "[]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `[{"op":"add","path":"/metadata/annotations/kube-image-deployer.history~1app","value":"[]"}]`
+	if string(patch) != expected {
+		t.Errorf("Expected: %s, Got: %s", expected, patch)
+	}
+
+	patch, err = GetImageStrategicPatchJson(newTestGenericWorkload(map[string]interface{}{"a": "b"}), nil, nil, map[string]string{"a": "", "missing": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `[{"op":"remove","path":"/metadata/annotations/a"}]`
+	if string(patch) != expected {
+		t.Errorf("Expected: %s, Got: %s", expected, patch)
+	}
+}
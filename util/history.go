@@ -0,0 +1,48 @@
+package util
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	HistoryAnnotation  = ".history/"  // <watchKey>.history/<containerName>=[{"image":"...","time":"..."}, ...]
+	DisabledAnnotation = ".disabled/" // <watchKey>.disabled/<containerName>=<reason>. 값이 있으면 container를 추적하지 않는다.
+	BadImageAnnotation = ".bad-image/" // <watchKey>.bad-image/<containerName>=<imageString>. rollout에 실패한 image. tag가 다른 image로 바뀌기 전까지 patch 하지 않는다.
+	MaxHistoryEntries  = 10
+)
+
+// HistoryEntry container에서 교체되기 전의 image와 교체된 시간
+type HistoryEntry struct {
+	Image string    `json:"image"`
+	Time  time.Time `json:"time"`
+}
+
+// ParseHistory history annotation 값을 파싱한다. 최신 항목이 앞에 위치한다.
+func ParseHistory(value string) ([]HistoryEntry, error) {
+	history := make([]HistoryEntry, 0)
+	if value == "" {
+		return history, nil
+	}
+	if err := json.Unmarshal([]byte(value), &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// AppendHistory image를 history 맨 앞에 추가하고 MaxHistoryEntries개까지만 유지한 annotation 값을 반환한다.
+// 기존 값을 파싱할 수 없으면 새 history로 시작한다.
+func AppendHistory(value string, image string, t time.Time) string {
+	history, err := ParseHistory(value)
+	if err != nil {
+		history = make([]HistoryEntry, 0)
+	}
+
+	history = append([]HistoryEntry{{Image: image, Time: t.UTC()}}, history...)
+	if len(history) > MaxHistoryEntries {
+		history = history[:MaxHistoryEntries]
+	}
+
+	b, _ := json.Marshal(history)
+	return string(b)
+}
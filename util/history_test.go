@@ -0,0 +1,44 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAppendHistory(t *testing.T) {
+	value := ""
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < MaxHistoryEntries+2; i++ {
+		value = AppendHistory(value, fmt.Sprintf("busybox@sha256:%d", i), now.Add(time.Duration(i)*time.Minute))
+	}
+
+	history, err := ParseHistory(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != MaxHistoryEntries {
+		t.Fatalf("Expected: %d entries, Got: %d", MaxHistoryEntries, len(history))
+	}
+
+	if history[0].Image != fmt.Sprintf("busybox@sha256:%d", MaxHistoryEntries+1) || !history[0].Time.Equal(now.Add(time.Duration(MaxHistoryEntries+1)*time.Minute)) {
+		t.Errorf("Expected: newest entry first, Got: %+v", history[0])
+	}
+
+	if history[MaxHistoryEntries-1].Image != "busybox@sha256:2" {
+		t.Errorf("Expected: oldest entries dropped, Got: %+v", history[MaxHistoryEntries-1])
+	}
+}
+
+func TestAppendHistoryInvalid(t *testing.T) {
+	history, err := ParseHistory(AppendHistory("invalid", "busybox@sha256:1", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 1 || history[0].Image != "busybox@sha256:1" {
+		t.Errorf("Expected: new history, Got: %+v", history)
+	}
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// policyTagRegex semver(...), regex(...) 형식의 tag는 name package로 검증할 수 없으므로 먼저 분리한다.
+var policyTagRegex = regexp.MustCompile(`^(.+?):((?:semver|regex)\(.*\))$`)
+
+// ParseImage image reference에서 url과 tag를 추출한다.
+// registry에 port가 포함된 경우(registry.internal:5000/team/app:1.2.*)도 처리하며, tag가 없으면 latest로 간주한다.
+// url은 go-containerregistry의 name package로 검증하며, exact tag도 동일하게 검증한다.
+func ParseImage(image string) (url string, tag string, err error) {
+
+	if strings.Contains(image, "@") {
+		return "", "", fmt.Errorf("image %q already has a digest", image)
+	}
+
+	if matches := policyTagRegex.FindStringSubmatch(image); matches != nil {
+		url, tag = matches[1], matches[2]
+	} else if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		url, tag = image[:idx], image[idx+1:]
+	} else {
+		url, tag = image, name.DefaultTag
+	}
+
+	if _, err := name.NewRepository(url); err != nil {
+		return "", "", err
+	}
+
+	if tag == "" {
+		return "", "", fmt.Errorf("image %q has an empty tag", image)
+	}
+
+	if _, _, ok := ParseRegexTag(tag); ok {
+		return url, tag, nil
+	} else if _, ok := ParseSemverTag(tag); ok {
+		return url, tag, nil
+	}
+
+	// *은 tag에 사용할 수 없는 문자이므로 숫자로 치환하여 검증한다.
+	if _, err := name.NewTag(url + ":" + strings.ReplaceAll(tag, "*", "0")); err != nil {
+		return "", "", err
+	}
+
+	return url, tag, nil
+}
+
+// GetRegistryHost image url의 registry host를 반환한다. ex> busybox -> index.docker.io
+// url을 파싱할 수 없으면 ""를 반환한다.
+func GetRegistryHost(url string) string {
+	repo, err := name.NewRepository(url)
+	if err != nil {
+		return ""
+	}
+	return repo.RegistryStr()
+}
+
+// GetRepositoryName image url의 정규화된 repository 이름을 반환한다. ex> busybox -> index.docker.io/library/busybox
+// url을 파싱할 수 없으면 ""를 반환한다.
+func GetRepositoryName(url string) string {
+	repo, err := name.NewRepository(url)
+	if err != nil {
+		return ""
+	}
+	return repo.Name()
+}
+
+// IsTagPattern tag가 *, semver(...), regex(...) 처럼 여러 tag 중 하나를 선택하는 형식인지 확인한다.
+func IsTagPattern(tag string) bool {
+	if _, ok := ParseSemverTag(tag); ok {
+		return true
+	} else if _, _, ok := ParseRegexTag(tag); ok {
+		return true
+	}
+	return strings.Contains(tag, "*")
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		image string
+		url   string
+		tag   string
+	}{
+		{"busybox:1.34.*", "busybox", "1.34.*"},
+		{"busybox", "busybox", "latest"},
+		{"registry.internal:5000/team/app:1.2.*", "registry.internal:5000/team/app", "1.2.*"},
+		{"registry.internal:5000/team/app", "registry.internal:5000/team/app", "latest"},
+		{"123456789012.dkr.ecr.ap-northeast-2.amazonaws.com/app:v1.0.0", "123456789012.dkr.ecr.ap-northeast-2.amazonaws.com/app", "v1.0.0"},
+		{"registry.internal:5000/app:semver(>=2.3.0 <3)", "registry.internal:5000/app", "semver(>=2.3.0 <3)"},
+		{"app:regex(main-(?P<order>\\d{8}):(?P<x>\\w+),date)", "app", "regex(main-(?P<order>\\d{8}):(?P<x>\\w+),date)"},
+	}
+
+	for _, test := range tests {
+		if url, tag, err := ParseImage(test.image); err != nil {
+			t.Errorf("ParseImage(%s) err: %v", test.image, err)
+		} else if url != test.url || tag != test.tag {
+			t.Errorf("ParseImage(%s) Expected: %s, %s, Got: %s, %s", test.image, test.url, test.tag, url, tag)
+		}
+	}
+}
+
+func TestParseImageInvalid(t *testing.T) {
+	for _, image := range []string{"", "busybox:", "Busybox:latest", "busybox:1.34:*", "busybox@sha256:15f840677a5e245d9ea199eb9b026b1539208a5183621dced7b469f6aa678115", "busybox:bad tag"} {
+		if url, tag, err := ParseImage(image); err == nil {
+			t.Errorf("ParseImage(%s) Expected: error, Got: %s, %s", image, url, tag)
+		}
+	}
+}
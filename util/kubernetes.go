@@ -7,6 +7,7 @@ import (
 
 	appV1 "k8s.io/api/apps/v1"
 	batchV1 "k8s.io/api/batch/v1"
+	batchV1beta1 "k8s.io/api/batch/v1beta1"
 	coreV1 "k8s.io/api/core/v1"
 )
 
@@ -15,8 +16,30 @@ type Container struct {
 	Image string `json:"image"`
 }
 
+type PatchMetadata struct {
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// MarshalJSON 값이 빈 문자열인 annotation은 null로 만들어 patch에서 삭제한다.
+func (m PatchMetadata) MarshalJSON() ([]byte, error) {
+	annotations := make(map[string]*string, len(m.Annotations))
+	for key, value := range m.Annotations {
+		if value == "" {
+			annotations[key] = nil
+		} else {
+			value := value
+			annotations[key] = &value
+		}
+	}
+
+	return json.Marshal(struct {
+		Annotations map[string]*string `json:"annotations,omitempty"`
+	}{annotations})
+}
+
 type ImageStrategicPatch struct {
-	Spec struct {
+	Metadata PatchMetadata `json:"metadata,omitempty"`
+	Spec     struct {
 		Template struct {
 			Spec struct {
 				Containers     []Container `json:"containers,omitempty"`
@@ -26,8 +49,10 @@ type ImageStrategicPatch struct {
 	} `json:"spec"`
 }
 
+// ImageStrategicPatchCronJob batch/v1, batch/v1beta1 CronJob의 image patch
 type ImageStrategicPatchCronJob struct {
-	Spec struct {
+	Metadata PatchMetadata `json:"metadata,omitempty"`
+	Spec     struct {
 		JobTemplate struct {
 			Spec struct {
 				Template struct {
@@ -49,8 +74,16 @@ func GetAnnotations(obj interface{}) (map[string]string, error) {
 		return t.Annotations, nil
 	case *appV1.DaemonSet:
 		return t.Annotations, nil
+	case *appV1.ReplicaSet:
+		return t.Annotations, nil
+	case *batchV1.Job:
+		return t.Annotations, nil
 	case *batchV1.CronJob:
 		return t.Annotations, nil
+	case *batchV1beta1.CronJob:
+		return t.Annotations, nil
+	case *GenericWorkload:
+		return t.GetAnnotations(), nil
 	default:
 		return make(map[string]string), fmt.Errorf("GetAnnotations unknown type %T", t)
 	}
@@ -64,8 +97,17 @@ func GetContainers(obj interface{}) ([]coreV1.Container, error) {
 		return t.Spec.Template.Spec.Containers, nil
 	case *appV1.DaemonSet:
 		return t.Spec.Template.Spec.Containers, nil
+	case *appV1.ReplicaSet:
+		return t.Spec.Template.Spec.Containers, nil
+	case *batchV1.Job:
+		return t.Spec.Template.Spec.Containers, nil
 	case *batchV1.CronJob:
 		return t.Spec.JobTemplate.Spec.Template.Spec.Containers, nil
+	case *batchV1beta1.CronJob:
+		return t.Spec.JobTemplate.Spec.Template.Spec.Containers, nil
+	case *GenericWorkload:
+		template, err := t.GetPodTemplate()
+		return template.Spec.Containers, err
 	default:
 		return make([]coreV1.Container, 0), fmt.Errorf("GetContainers unknown type %T", t)
 	}
@@ -79,8 +121,17 @@ func GetInitContainers(obj interface{}) ([]coreV1.Container, error) {
 		return t.Spec.Template.Spec.InitContainers, nil
 	case *appV1.DaemonSet:
 		return t.Spec.Template.Spec.InitContainers, nil
+	case *appV1.ReplicaSet:
+		return t.Spec.Template.Spec.InitContainers, nil
+	case *batchV1.Job:
+		return t.Spec.Template.Spec.InitContainers, nil
 	case *batchV1.CronJob:
 		return t.Spec.JobTemplate.Spec.Template.Spec.InitContainers, nil
+	case *batchV1beta1.CronJob:
+		return t.Spec.JobTemplate.Spec.Template.Spec.InitContainers, nil
+	case *GenericWorkload:
+		template, err := t.GetPodTemplate()
+		return template.Spec.InitContainers, err
 	default:
 		return make([]coreV1.Container, 0), fmt.Errorf("GetInitContainers unknown type %T", t)
 	}
@@ -124,17 +175,24 @@ func GetNamespaceNameByKey(key string) (namespace string, name string) {
 	return
 }
 
-func GetImageStrategicPatchJson(obj interface{}, containers, initContainers []Container) ([]byte, error) {
+// GetImageStrategicPatchJson containers, initContainers의 image와 workload의 annotations를 변경하는 strategic merge patch를 생성한다.
+// GenericWorkload는 JSON patch를 생성한다.
+// 값이 빈 문자열인 annotation은 삭제한다.
+func GetImageStrategicPatchJson(obj interface{}, containers, initContainers []Container, annotations map[string]string) ([]byte, error) {
 	var imageStrategicPatch interface{}
 
-	switch obj.(type) {
-	case *batchV1.CronJob:
+	switch t := obj.(type) {
+	case *GenericWorkload:
+		return t.getImageJSONPatch(containers, initContainers, annotations)
+	case *batchV1.CronJob, *batchV1beta1.CronJob: // jobTemplate은 batch/v1, batch/v1beta1에서 같은 구조
 		p := ImageStrategicPatchCronJob{}
+		p.Metadata.Annotations = annotations
 		p.Spec.JobTemplate.Spec.Template.Spec.Containers = containers
 		p.Spec.JobTemplate.Spec.Template.Spec.InitContainers = initContainers
 		imageStrategicPatch = p
 	default:
 		p := ImageStrategicPatch{}
+		p.Metadata.Annotations = annotations
 		p.Spec.Template.Spec.Containers = containers
 		p.Spec.Template.Spec.InitContainers = initContainers
 		imageStrategicPatch = p
@@ -142,3 +200,120 @@ func GetImageStrategicPatchJson(obj interface{}, containers, initContainers []Co
 	patchJson, err := json.Marshal(imageStrategicPatch)
 	return patchJson, err
 }
+
+func GetPodSpec(obj interface{}) (coreV1.PodSpec, error) {
+	switch t := obj.(type) {
+	case *appV1.Deployment:
+		return t.Spec.Template.Spec, nil
+	case *appV1.StatefulSet:
+		return t.Spec.Template.Spec, nil
+	case *appV1.DaemonSet:
+		return t.Spec.Template.Spec, nil
+	case *appV1.ReplicaSet:
+		return t.Spec.Template.Spec, nil
+	case *batchV1.Job:
+		return t.Spec.Template.Spec, nil
+	case *batchV1.CronJob:
+		return t.Spec.JobTemplate.Spec.Template.Spec, nil
+	case *batchV1beta1.CronJob:
+		return t.Spec.JobTemplate.Spec.Template.Spec, nil
+	case *GenericWorkload:
+		template, err := t.GetPodTemplate()
+		return template.Spec, err
+	default:
+		return coreV1.PodSpec{}, fmt.Errorf("GetPodSpec unknown type %T", t)
+	}
+}
+
+// IsRolloutComplete workload의 모든 replica가 최신 pod template으로 교체되고 available 상태인지 확인한다.
+// rollout 상태가 없는 kind(CronJob, Job, ReplicaSet)와 patch만으로 rollout이 완료되지 않는 workload
+// (OnDelete update strategy, partition이 있는 StatefulSet, paused Deployment)는 supported=false를 반환한다.
+func IsRolloutComplete(obj interface{}) (complete bool, supported bool) {
+	switch t := obj.(type) {
+	case *appV1.Deployment:
+		if t.Spec.Paused {
+			return false, false
+		}
+		replicas := getReplicas(t.Spec.Replicas)
+		return t.Status.ObservedGeneration >= t.Generation &&
+			t.Status.UpdatedReplicas == replicas &&
+			t.Status.AvailableReplicas == replicas &&
+			t.Status.Replicas == replicas, true
+	case *appV1.StatefulSet:
+		if t.Spec.UpdateStrategy.Type == appV1.OnDeleteStatefulSetStrategyType {
+			return false, false
+		}
+		if rollingUpdate := t.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil && *rollingUpdate.Partition > 0 {
+			return false, false
+		}
+		replicas := getReplicas(t.Spec.Replicas)
+		return t.Status.ObservedGeneration >= t.Generation &&
+			t.Status.UpdatedReplicas == replicas &&
+			t.Status.AvailableReplicas == replicas, true
+	case *appV1.DaemonSet:
+		if t.Spec.UpdateStrategy.Type == appV1.OnDeleteDaemonSetStrategyType {
+			return false, false
+		}
+		return t.Status.ObservedGeneration >= t.Generation &&
+			t.Status.UpdatedNumberScheduled == t.Status.DesiredNumberScheduled &&
+			t.Status.NumberAvailable == t.Status.DesiredNumberScheduled, true
+	default:
+		return false, false
+	}
+}
+
+// getReplicas spec.replicas가 없으면 기본값 1
+func getReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// GetPlatformFromPodSpec returns the "os/arch" platform string the pods are pinned to by
+// nodeSelector or required node affinity on kubernetes.io/arch (and kubernetes.io/os).
+// ok is false when the architecture is not pinned to exactly one value.
+func GetPlatformFromPodSpec(spec coreV1.PodSpec) (platformString string, ok bool) {
+	os := spec.NodeSelector[coreV1.LabelOSStable]
+	arch := spec.NodeSelector[coreV1.LabelArchStable]
+
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil && spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		// nodeSelectorTerms are ORed, so every term must pin the same single value
+		terms := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		if arch == "" {
+			arch = getSingleNodeSelectorTermsValue(terms, coreV1.LabelArchStable)
+		}
+		if os == "" {
+			os = getSingleNodeSelectorTermsValue(terms, coreV1.LabelOSStable)
+		}
+	}
+
+	if arch == "" {
+		return "", false
+	}
+
+	if os == "" {
+		os = "linux"
+	}
+
+	return os + "/" + arch, true
+}
+
+func getSingleNodeSelectorTermsValue(terms []coreV1.NodeSelectorTerm, key string) string {
+	value := ""
+
+	for _, term := range terms {
+		termValue := ""
+		for _, expr := range term.MatchExpressions {
+			if expr.Key == key && expr.Operator == coreV1.NodeSelectorOpIn && len(expr.Values) == 1 {
+				termValue = expr.Values[0]
+			}
+		}
+		if termValue == "" || (value != "" && value != termValue) {
+			return ""
+		}
+		value = termValue
+	}
+
+	return value
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+	"testing"
+
+	appV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
+	batchV1beta1 "k8s.io/api/batch/v1beta1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPlatformFromPodSpecNodeSelector(t *testing.T) {
+	spec := coreV1.PodSpec{NodeSelector: map[string]string{coreV1.LabelArchStable: "arm64"}}
+
+	if platform, ok := GetPlatformFromPodSpec(spec); !ok || platform != "linux/arm64" {
+		t.Errorf("Expected: linux/arm64, Got: %s", platform)
+	}
+}
+
+func TestGetPlatformFromPodSpecAffinity(t *testing.T) {
+	term := func(values ...string) coreV1.NodeSelectorTerm {
+		return coreV1.NodeSelectorTerm{MatchExpressions: []coreV1.NodeSelectorRequirement{
+			{Key: coreV1.LabelArchStable, Operator: coreV1.NodeSelectorOpIn, Values: values},
+		}}
+	}
+	spec := func(terms ...coreV1.NodeSelectorTerm) coreV1.PodSpec {
+		return coreV1.PodSpec{Affinity: &coreV1.Affinity{NodeAffinity: &coreV1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &coreV1.NodeSelector{NodeSelectorTerms: terms},
+		}}}
+	}
+
+	if platform, ok := GetPlatformFromPodSpec(spec(term("arm64"), term("arm64"))); !ok || platform != "linux/arm64" {
+		t.Errorf("Expected: linux/arm64, Got: %s", platform)
+	}
+
+	if platform, ok := GetPlatformFromPodSpec(spec(term("arm64", "amd64"))); ok {
+		t.Errorf("Expected: not pinned, Got: %s", platform)
+	}
+
+	if platform, ok := GetPlatformFromPodSpec(spec(term("arm64"), term("amd64"))); ok {
+		t.Errorf("Expected: not pinned, Got: %s", platform)
+	}
+
+	if platform, ok := GetPlatformFromPodSpec(coreV1.PodSpec{}); ok {
+		t.Errorf("Expected: not pinned, Got: %s", platform)
+	}
+}
+
+func TestIsRolloutComplete(t *testing.T) {
+	replicas := int32(2)
+	deployment := func(observedGeneration int64, updated, available, total int32) *appV1.Deployment {
+		return &appV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{Generation: 2},
+			Spec:       appV1.DeploymentSpec{Replicas: &replicas},
+			Status: appV1.DeploymentStatus{
+				ObservedGeneration: observedGeneration,
+				UpdatedReplicas:    updated,
+				AvailableReplicas:  available,
+				Replicas:           total,
+			},
+		}
+	}
+
+	tests := []struct {
+		obj      interface{}
+		complete bool
+	}{
+		{deployment(2, 2, 2, 2), true},
+		{deployment(1, 2, 2, 2), false}, // 변경된 spec이 아직 반영되지 않음
+		{deployment(2, 1, 2, 3), false}, // 이전 replica가 남아있음
+		{deployment(2, 2, 1, 2), false}, // crash loop
+		{&appV1.DaemonSet{Status: appV1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3}}, true},
+		{&appV1.DaemonSet{Status: appV1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 2}}, false},
+	}
+
+	for i, test := range tests {
+		if complete, supported := IsRolloutComplete(test.obj); !supported || complete != test.complete {
+			t.Errorf("[%d] Expected: %v, Got: %v, supported=%v", i, test.complete, complete, supported)
+		}
+	}
+
+	partition := int32(1)
+	unsupported := []interface{}{
+		&batchV1.CronJob{},
+		&appV1.Deployment{Spec: appV1.DeploymentSpec{Paused: true}},
+		&appV1.StatefulSet{Spec: appV1.StatefulSetSpec{UpdateStrategy: appV1.StatefulSetUpdateStrategy{Type: appV1.OnDeleteStatefulSetStrategyType}}},
+		&appV1.StatefulSet{Spec: appV1.StatefulSetSpec{UpdateStrategy: appV1.StatefulSetUpdateStrategy{
+			Type:          appV1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appV1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+		}}},
+		&appV1.DaemonSet{Spec: appV1.DaemonSetSpec{UpdateStrategy: appV1.DaemonSetUpdateStrategy{Type: appV1.OnDeleteDaemonSetStrategyType}}},
+	}
+	for i, obj := range unsupported { // patch만으로 rollout이 완료되지 않음
+		if _, supported := IsRolloutComplete(obj); supported {
+			t.Errorf("[%d] Expected: %T not supported", i, obj)
+		}
+	}
+}
+
+// batch/v1beta1 CronJob도 jobTemplate을 patch 해야 한다.
+func TestGetImageStrategicPatchJsonCronJobV1beta1(t *testing.T) {
+	cronJob := &batchV1beta1.CronJob{}
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers = []coreV1.Container{{Name: "app", Image: "busybox@sha256:1"}}
+
+	if containers, err := GetContainers(cronJob); err != nil || len(containers) != 1 {
+		t.Fatalf("Expected: 1 container, Got: %v, %v", containers, err)
+	}
+
+	data, err := GetImageStrategicPatchJson(cronJob, []Container{{Name: "app", Image: "busybox@sha256:2"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"metadata":{},"spec":{"jobTemplate":{"spec":{"template":{"spec":{"containers":[{"name":"app","image":"busybox@sha256:2"}]}}}}}}`
+	if string(data) != expected {
+		t.Errorf("Expected: %s, Got: %s", expected, data)
+	}
+}
+
+// 값이 빈 문자열인 annotation은 null로 patch 하여 삭제해야 한다.
+func TestGetImageStrategicPatchJsonRemoveAnnotation(t *testing.T) {
+	data, err := GetImageStrategicPatchJson(&appV1.Deployment{}, nil, nil, map[string]string{"a": "b", "c": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"metadata":{"annotations":{"a":"b","c":null}},"spec":{"template":{"spec":{}}}}`
+	if string(data) != expected {
+		t.Errorf("Expected: %s, Got: %s", expected, data)
+	}
+}
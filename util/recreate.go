@@ -0,0 +1,78 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	batchV1 "k8s.io/api/batch/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// recreateTimeout time to wait for the deleted workload to disappear before creating it again
+const recreateTimeout = time.Minute
+
+// jobGeneratedLabels labels generated from the uid of the Job. They must be removed to create the Job again
+var jobGeneratedLabels = []string{"controller-uid", "job-name", "batch.kubernetes.io/controller-uid", "batch.kubernetes.io/job-name"}
+
+// ApplyPatchLocally applies the strategic merge patch to original and stores the result in patched
+func ApplyPatchLocally(original interface{}, data []byte, patched interface{}) error {
+	originalJson, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+
+	patchedJson, err := strategicpatch.StrategicMergePatch(originalJson, data, patched)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(patchedJson, patched)
+}
+
+// Recreate deletes the workload of uid, waits until it disappears and creates it again.
+// On dry-run only the deletion is validated, because the workload still exists when it is created.
+func Recreate(ctx context.Context, uid types.UID, dryRun bool, delete func(metaV1.DeleteOptions) error, get func() error, create func() error) error {
+	propagation := metaV1.DeletePropagationBackground
+	options := metaV1.DeleteOptions{PropagationPolicy: &propagation, Preconditions: &metaV1.Preconditions{UID: &uid}}
+
+	if dryRun {
+		options.DryRun = []string{metaV1.DryRunAll}
+		return delete(options)
+	}
+
+	if err := delete(options); err != nil {
+		return err
+	}
+
+	if err := wait.PollImmediateWithContext(ctx, time.Second, recreateTimeout, func(ctx context.Context) (bool, error) {
+		return apiErrors.IsNotFound(get()), nil
+	}); err != nil {
+		return fmt.Errorf("deleted but not recreated, waiting for the deletion: %w", err)
+	}
+
+	if err := retry.OnError(retry.DefaultBackoff, func(err error) bool { return !apiErrors.IsInvalid(err) }, create); err != nil {
+		return fmt.Errorf("deleted but not recreated: %w", err)
+	}
+	return nil
+}
+
+// CleanJobForRecreate removes the fields generated by the API server so that the Job can be created again
+func CleanJobForRecreate(job *batchV1.Job) {
+	job.ObjectMeta = metaV1.ObjectMeta{Name: job.Name, Namespace: job.Namespace, Labels: job.Labels, Annotations: job.Annotations}
+	job.Status = batchV1.JobStatus{}
+
+	if job.Spec.ManualSelector == nil || !*job.Spec.ManualSelector {
+		job.Spec.Selector = nil
+		for _, label := range jobGeneratedLabels {
+			delete(job.Labels, label)
+			delete(job.Spec.Template.Labels, label)
+		}
+	}
+}
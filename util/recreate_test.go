@@ -0,0 +1,46 @@
+package util
+
+import (
+	"testing"
+
+	batchV1 "k8s.io/api/batch/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recreate 할 Job에서 API server가 생성한 field와 selector를 제거하고, patch한 image를 사용해야 한다.
+func TestRecreateJob(t *testing.T) {
+	generatedLabels := map[string]string{"app": "migrate", "controller-uid": "1", "job-name": "migrate"}
+	job := &batchV1.Job{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "default", Name: "migrate", UID: "1", ResourceVersion: "10", Labels: generatedLabels},
+		Spec: batchV1.JobSpec{
+			Selector: &metaV1.LabelSelector{MatchLabels: map[string]string{"controller-uid": "1"}},
+			Template: coreV1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: generatedLabels},
+				Spec:       coreV1.PodSpec{Containers: []coreV1.Container{{Name: "app", Image: "busybox@sha256:1"}}},
+			},
+		},
+		Status: batchV1.JobStatus{Succeeded: 1},
+	}
+
+	data, err := GetImageStrategicPatchJson(job, []Container{{Name: "app", Image: "busybox@sha256:2"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched := &batchV1.Job{}
+	if err := ApplyPatchLocally(job, data, patched); err != nil {
+		t.Fatal(err)
+	}
+	CleanJobForRecreate(patched)
+
+	if image := patched.Spec.Template.Spec.Containers[0].Image; image != "busybox@sha256:2" {
+		t.Errorf("Expected: busybox@sha256:2, Got: %s", image)
+	}
+	if patched.UID != "" || patched.ResourceVersion != "" || patched.Status.Succeeded != 0 || patched.Spec.Selector != nil {
+		t.Errorf("Expected: generated fields removed, Got: %+v", patched)
+	}
+	if len(patched.Labels) != 1 || len(patched.Spec.Template.Labels) != 1 || patched.Labels["app"] != "migrate" {
+		t.Errorf("Expected: labels {app: migrate}, Got: %v, %v", patched.Labels, patched.Spec.Template.Labels)
+	}
+}
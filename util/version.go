@@ -6,6 +6,9 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
 )
 
 var ErrNotFound = errors.New("not found")
@@ -60,3 +63,184 @@ func GetHighestVersionWithFilter(versions []string, filter string) (string, erro
 
 	return highestTag, nil
 }
+
+var semverTagRegex = regexp.MustCompile(`^semver\((.+)\)$`)
+
+// ParseSemverTag tag가 semver(<constraint>) 형식이면 constraint를 반환한다.
+// 예를 들어, "semver(~1.4)"는 "~1.4"를 반환한다.
+func ParseSemverTag(tag string) (string, bool) {
+	matches := semverTagRegex.FindStringSubmatch(tag)
+	if len(matches) != 2 {
+		return "", false
+	}
+	return strings.TrimSpace(matches[1]), true
+}
+
+// GetHighestSemverWithConstraint versions 중 semver constraint를 만족하는 가장 높은 버전을 반환한다.
+// constraint는 "^1.4", "~1.4", ">=2.3.0 <3", "1.x" 와 같은 형식이다.
+// version은 "v" prefix를 허용하며 그 외에는 semver 2.0.0 형식을 엄격하게 따라야 한다.
+// prerelease 버전은 constraint에 prerelease가 포함된 경우에만 대상이 되며,
+// semver 규칙에 따라 1.5.0-rc.1은 1.5.0보다 낮다. build metadata는 우선순위에 영향을 주지 않는다.
+func GetHighestSemverWithConstraint(versions []string, constraint string) (string, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	highestTag := ""
+	var highestVersion *semver.Version
+
+	for _, tag := range versions {
+		v, err := semver.StrictNewVersion(strings.TrimPrefix(tag, "v"))
+		if err != nil { // semver가 아닌 tag는 무시한다.
+			continue
+		}
+
+		if !c.Check(v) {
+			continue
+		}
+
+		if highestVersion == nil || v.GreaterThan(highestVersion) {
+			highestTag, highestVersion = tag, v
+		}
+	}
+
+	if highestTag == "" {
+		return "", ErrNotFound
+	}
+
+	return highestTag, nil
+}
+
+const (
+	RegexSortNumeric = "numeric" // order group을 10진수 숫자로 비교한다.
+	RegexSortLexical = "lexical" // order group을 문자열로 비교한다.
+	RegexSortDate    = "date"    // order group을 날짜로 비교한다. regexDateLayouts 중 하나로 파싱되어야 한다.
+
+	regexOrderGroupName = "order"
+)
+
+var regexTagRegex = regexp.MustCompile(`^regex\((.+)\)$`)
+
+// regexDateLayouts date 정렬시 순서대로 시도하는 날짜 형식
+var regexDateLayouts = []string{
+	"20060102150405",
+	"200601021504",
+	"20060102",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+	"2006.01.02",
+}
+
+// ParseRegexTag tag가 regex(<pattern>) 또는 regex(<pattern>,<sortKind>) 형식이면 pattern과 sortKind를 반환한다.
+// sortKind는 numeric, lexical, date 중 하나이며 생략시 numeric이다.
+// 예를 들어, "regex(^main-(?P<order>\d{8})-[0-9a-f]+$,date)"는 "^main-(?P<order>\d{8})-[0-9a-f]+$", "date"를 반환한다.
+func ParseRegexTag(tag string) (pattern string, sortKind string, ok bool) {
+	matches := regexTagRegex.FindStringSubmatch(tag)
+	if len(matches) != 2 {
+		return "", "", false
+	}
+
+	body := matches[1]
+
+	// 마지막 , 뒤가 sortKind인 경우에만 분리한다. pattern 내부의 ,({1,3} 등)는 그대로 둔다.
+	if idx := strings.LastIndex(body, ","); idx >= 0 {
+		switch kind := strings.TrimSpace(body[idx+1:]); kind {
+		case RegexSortNumeric, RegexSortLexical, RegexSortDate:
+			return body[:idx], kind, true
+		}
+	}
+
+	return body, RegexSortNumeric, true
+}
+
+// GetHighestTagWithRegex tags 중 pattern에 일치하는 tag에서 order group이 가장 큰 tag를 반환한다.
+// pattern은 tag 전체와 일치해야 하며 (?P<order>...) named group을 반드시 포함해야 한다.
+// order group을 sortKind로 변환할 수 없는 tag는 무시한다.
+func GetHighestTagWithRegex(tags []string, pattern, sortKind string) (string, error) {
+	patt, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", pattern))
+	if err != nil {
+		return "", err
+	}
+
+	orderIndex := patt.SubexpIndex(regexOrderGroupName)
+	if orderIndex < 0 {
+		return "", fmt.Errorf("regex tag pattern %q has no (?P<%s>...) group", pattern, regexOrderGroupName)
+	}
+
+	var less func(a, b string) bool
+
+	switch sortKind {
+	case RegexSortNumeric:
+		less = lessNumericString
+	case RegexSortLexical:
+		less = func(a, b string) bool { return a < b }
+	case RegexSortDate:
+		less = func(a, b string) bool { return parseRegexDate(a).Before(parseRegexDate(b)) }
+	default:
+		return "", fmt.Errorf("unknown regex tag sort kind %q", sortKind)
+	}
+
+	highestTag, highestOrder := "", ""
+
+	for _, tag := range tags {
+		matches := patt.FindStringSubmatch(tag)
+
+		if tag == "" || matches == nil {
+			continue
+		}
+
+		order := matches[orderIndex]
+
+		if !isValidRegexOrder(order, sortKind) {
+			continue
+		}
+
+		if highestTag == "" || less(highestOrder, order) {
+			highestTag, highestOrder = tag, order
+		}
+	}
+
+	if highestTag == "" {
+		return "", ErrNotFound
+	}
+
+	return highestTag, nil
+}
+
+func isValidRegexOrder(order, sortKind string) bool {
+	switch sortKind {
+	case RegexSortNumeric:
+		if order == "" {
+			return false
+		}
+		for _, r := range order {
+			if r < '0' || r > '9' {
+				return false
+			}
+		}
+		return true
+	case RegexSortDate:
+		return !parseRegexDate(order).IsZero()
+	default:
+		return order != ""
+	}
+}
+
+// lessNumericString 10진수 문자열을 크기로 비교한다. int64 범위를 넘는 숫자도 비교할 수 있다.
+func lessNumericString(a, b string) bool {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func parseRegexDate(s string) time.Time {
+	for _, layout := range regexDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -37,3 +37,89 @@ func TestGetHighestVersionWithFilterAsteriskNotMatch(t *testing.T) {
 		t.Errorf("Expected: v6.0.0, Got: %s", highestVersion)
 	}
 }
+
+var semverVersions []string = []string{"1.3.9", "1.4.0", "1.4.7", "v1.4.8", "1.5.0-rc.1", "1.5.0", "1.5.1-beta", "2.3.0", "2.9.1", "3.0.0", "latest", "1.4", "main-1234"}
+
+func TestParseSemverTag(t *testing.T) {
+	if constraint, ok := ParseSemverTag("semver(>=2.3.0 <3)"); !ok || constraint != ">=2.3.0 <3" {
+		t.Errorf("Expected: >=2.3.0 <3, Got: %s", constraint)
+	}
+
+	if _, ok := ParseSemverTag("1.4.*"); ok {
+		t.Errorf("Expected: not semver tag")
+	}
+}
+
+func TestGetHighestSemverWithConstraint(t *testing.T) {
+	if highestVersion, _ := GetHighestSemverWithConstraint(semverVersions, "~1.4"); highestVersion != "v1.4.8" {
+		t.Errorf("Expected: v1.4.8, Got: %s", highestVersion)
+	}
+
+	if highestVersion, _ := GetHighestSemverWithConstraint(semverVersions, "^1.4"); highestVersion != "1.5.0" {
+		t.Errorf("Expected: 1.5.0, Got: %s", highestVersion)
+	}
+
+	if highestVersion, _ := GetHighestSemverWithConstraint(semverVersions, ">=2.3.0 <3"); highestVersion != "2.9.1" {
+		t.Errorf("Expected: 2.9.1, Got: %s", highestVersion)
+	}
+}
+
+func TestGetHighestSemverWithConstraintPrerelease(t *testing.T) {
+	if highestVersion, _ := GetHighestSemverWithConstraint(semverVersions, "1.x"); highestVersion != "1.5.0" {
+		t.Errorf("Expected: 1.5.0, Got: %s", highestVersion)
+	}
+
+	if highestVersion, _ := GetHighestSemverWithConstraint(semverVersions, ">=1.5.0-0 <1.6.0-0"); highestVersion != "1.5.1-beta" {
+		t.Errorf("Expected: 1.5.1-beta, Got: %s", highestVersion)
+	}
+
+	if highestVersion, _ := GetHighestSemverWithConstraint([]string{"1.5.0-rc.1", "1.5.0"}, ">=1.5.0-0"); highestVersion != "1.5.0" {
+		t.Errorf("Expected: 1.5.0, Got: %s", highestVersion)
+	}
+}
+
+func TestGetHighestSemverWithConstraintNotFound(t *testing.T) {
+	if _, err := GetHighestSemverWithConstraint(semverVersions, "^4"); err != ErrNotFound {
+		t.Errorf("Expected: ErrNotFound, Got: %v", err)
+	}
+}
+
+var regexTags []string = []string{"main-20240512-8f3a2c1", "main-20240601-1a2b3c4", "main-20240530-ffffff0", "dev-20250101-0000000", "build-99", "build-1234", "build-0999", "build-abc", "latest"}
+
+func TestParseRegexTag(t *testing.T) {
+	if pattern, sortKind, ok := ParseRegexTag(`regex(main-(?P<order>\d{8})-[0-9a-f]+,date)`); !ok || pattern != `main-(?P<order>\d{8})-[0-9a-f]+` || sortKind != RegexSortDate {
+		t.Errorf("Expected: date pattern, Got: %s, %s", pattern, sortKind)
+	}
+
+	if pattern, sortKind, ok := ParseRegexTag(`regex(build-(?P<order>\d{1,5}))`); !ok || pattern != `build-(?P<order>\d{1,5})` || sortKind != RegexSortNumeric {
+		t.Errorf("Expected: numeric pattern, Got: %s, %s", pattern, sortKind)
+	}
+
+	if _, _, ok := ParseRegexTag("1.4.*"); ok {
+		t.Errorf("Expected: not regex tag")
+	}
+}
+
+func TestGetHighestTagWithRegex(t *testing.T) {
+	if highestTag, _ := GetHighestTagWithRegex(regexTags, `main-(?P<order>\d{8})-[0-9a-f]+`, RegexSortDate); highestTag != "main-20240601-1a2b3c4" {
+		t.Errorf("Expected: main-20240601-1a2b3c4, Got: %s", highestTag)
+	}
+
+	if highestTag, _ := GetHighestTagWithRegex(regexTags, `build-(?P<order>\d+)`, RegexSortNumeric); highestTag != "build-1234" {
+		t.Errorf("Expected: build-1234, Got: %s", highestTag)
+	}
+
+	if highestTag, _ := GetHighestTagWithRegex(regexTags, `build-(?P<order>\w+)`, RegexSortLexical); highestTag != "build-abc" {
+		t.Errorf("Expected: build-abc, Got: %s", highestTag)
+	}
+}
+
+func TestGetHighestTagWithRegexInvalid(t *testing.T) {
+	if _, err := GetHighestTagWithRegex(regexTags, `build-(\d+)`, RegexSortNumeric); err == nil {
+		t.Errorf("Expected: error for missing order group")
+	}
+
+	if _, err := GetHighestTagWithRegex(regexTags, `release-(?P<order>\d+)`, RegexSortNumeric); err != ErrNotFound {
+		t.Errorf("Expected: ErrNotFound, Got: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window patch를 적용할 수 있는 시간대 목록
+type Window struct {
+	ranges []windowRange
+}
+
+type windowRange struct {
+	days     [7]bool
+	start    int // 00:00부터의 분
+	end      int // start보다 작으면 다음날 end까지
+	location *time.Location
+}
+
+// ParseWindow "<days> <HH:MM>-<HH:MM> [<time zone>]" 형식의 window를 파싱한다. ";"로 여러 window를 지정할 수 있다.
+// days는 "Mon-Fri", "Sat,Sun", "Mon-Wed,Fri", "*" 형식이며, time zone을 생략하면 UTC를 사용한다.
+// 끝 시간이 시작 시간보다 이르면 다음날까지 이어지는 window이다. (Fri 22:00-02:00은 토요일 02:00까지)
+//
+//	Mon-Fri 02:00-05:00 Asia/Seoul
+//	Sat,Sun 00:00-24:00; Mon-Fri 22:00-06:00 Asia/Seoul
+func ParseWindow(value string) (*Window, error) {
+	window := &Window{ranges: make([]windowRange, 0)}
+
+	for _, s := range strings.Split(value, ";") {
+		r, err := parseWindowRange(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", s, err)
+		}
+		window.ranges = append(window.ranges, r)
+	}
+
+	return window, nil
+}
+
+func parseWindowRange(s string) (windowRange, error) {
+	r := windowRange{location: time.UTC}
+	fields := strings.Fields(s)
+
+	if len(fields) < 2 || len(fields) > 3 {
+		return r, fmt.Errorf("expected \"<days> <HH:MM>-<HH:MM> [<time zone>]\"")
+	}
+
+	days, err := parseWindowDays(fields[0])
+	if err != nil {
+		return r, err
+	}
+	r.days = days
+
+	times := strings.SplitN(fields[1], "-", 2)
+	if len(times) != 2 {
+		return r, fmt.Errorf("invalid time range %q", fields[1])
+	}
+	if r.start, err = parseWindowTime(times[0]); err != nil {
+		return r, err
+	}
+	if r.end, err = parseWindowTime(times[1]); err != nil {
+		return r, err
+	}
+	if r.start == r.end {
+		return r, fmt.Errorf("empty time range %q", fields[1])
+	}
+
+	if len(fields) == 3 {
+		if r.location, err = time.LoadLocation(fields[2]); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+func parseWindowDays(s string) (days [7]bool, err error) {
+	if s == "*" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+
+		from, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q", bounds[0])
+		}
+
+		to := from
+		if len(bounds) == 2 {
+			if to, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+				return days, fmt.Errorf("invalid day %q", bounds[1])
+			}
+		}
+
+		for d := from; ; d = (d + 1) % 7 { // Fri-Mon 처럼 주말을 넘어가는 범위 허용
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+// parseWindowTime "HH:MM"을 00:00부터의 분으로 변환한다. 24:00을 허용한다.
+func parseWindowTime(s string) (int, error) {
+	hm := strings.SplitN(s, ":", 2)
+	if len(hm) != 2 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	h, err := strconv.Atoi(hm[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	m, err := strconv.Atoi(hm[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	return h*60 + m, nil
+}
+
+// Contains t가 window 안에 있는지 확인한다.
+func (w *Window) Contains(t time.Time) bool {
+	for _, r := range w.ranges {
+		if r.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r windowRange) contains(t time.Time) bool {
+	t = t.In(r.location)
+	minutes := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	if r.start < r.end {
+		return r.days[today] && minutes >= r.start && minutes < r.end
+	}
+
+	// 자정을 넘어가는 window
+	return (r.days[today] && minutes >= r.start) || (r.days[yesterday] && minutes < r.end)
+}
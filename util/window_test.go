@@ -0,0 +1,58 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowContains(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		window   string
+		time     time.Time
+		contains bool
+	}{
+		{"Mon-Fri 02:00-05:00 Asia/Seoul", time.Date(2023, 3, 6, 2, 0, 0, 0, seoul), true},      // Mon
+		{"Mon-Fri 02:00-05:00 Asia/Seoul", time.Date(2023, 3, 6, 5, 0, 0, 0, seoul), false},     // end exclusive
+		{"Mon-Fri 02:00-05:00 Asia/Seoul", time.Date(2023, 3, 5, 17, 30, 0, 0, time.UTC), true}, // Mon 02:30 KST
+		{"Mon-Fri 02:00-05:00 Asia/Seoul", time.Date(2023, 3, 4, 3, 0, 0, 0, seoul), false},     // Sat
+		{"Mon-Fri 02:00-05:00", time.Date(2023, 3, 6, 3, 0, 0, 0, seoul), false},                // UTC
+		{"Fri 22:00-02:00", time.Date(2023, 3, 4, 1, 0, 0, 0, time.UTC), true},                  // Sat 01:00
+		{"Fri 22:00-02:00", time.Date(2023, 3, 5, 1, 0, 0, 0, time.UTC), false},                 // Sun 01:00
+		{"Sat,Sun 00:00-24:00; Mon-Fri 22:00-06:00", time.Date(2023, 3, 5, 12, 0, 0, 0, time.UTC), true},
+		{"Sat,Sun 00:00-24:00; Mon-Fri 22:00-06:00", time.Date(2023, 3, 7, 12, 0, 0, 0, time.UTC), false},
+		{"Fri-Mon 10:00-11:00", time.Date(2023, 3, 5, 10, 30, 0, 0, time.UTC), true}, // Sun
+		{"* 10:00-11:00", time.Date(2023, 3, 8, 10, 30, 0, 0, time.UTC), true},
+	}
+
+	for _, test := range tests {
+		window, err := ParseWindow(test.window)
+		if err != nil {
+			t.Errorf("ParseWindow(%s) err: %v", test.window, err)
+			continue
+		}
+		if contains := window.Contains(test.time); contains != test.contains {
+			t.Errorf("%s Contains(%s) Expected: %v, Got: %v", test.window, test.time, test.contains, contains)
+		}
+	}
+}
+
+func TestParseWindowInvalid(t *testing.T) {
+	for _, window := range []string{
+		"",
+		"Mon-Fri",
+		"Mon-Fri 02:00",
+		"Mon-Foo 02:00-05:00",
+		"Mon-Fri 02:00-25:00",
+		"Mon-Fri 02:00-02:00",
+		"Mon-Fri 02:00-05:00 Asia/Nowhere",
+	} {
+		if _, err := ParseWindow(window); err == nil {
+			t.Errorf("ParseWindow(%s) Expected: error", window)
+		}
+	}
+}
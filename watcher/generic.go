@@ -0,0 +1,107 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/controller"
+	"github.com/pubg/kube-image-deployer/interfaces"
+	"github.com/pubg/kube-image-deployer/util"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	pkgRuntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// GenericWorkload a custom resource kind with an embedded pod template
+type GenericWorkload struct {
+	Resource     schema.GroupVersionResource
+	TemplatePath []string // path to the PodTemplateSpec, e.g. [spec template]
+}
+
+// ParseGenericWorkloads parses comma separated "<resource>.<version>.<group>=<JSONPath to the pod template>" entries
+//
+//	rollouts.v1alpha1.argoproj.io=.spec.template,clonesets.v1alpha1.apps.kruise.io=.spec.template
+func ParseGenericWorkloads(value string) ([]GenericWorkload, error) {
+	workloads := make([]GenericWorkload, 0)
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid generic workload %q: expected <resource>.<version>.<group>=<JSONPath>", entry)
+		}
+
+		gvr, _ := schema.ParseResourceArg(kv[0])
+		if gvr == nil || gvr.Group == "" {
+			return nil, fmt.Errorf("invalid generic workload %q: expected <resource>.<version>.<group>", kv[0])
+		}
+
+		templatePath, err := util.ParseTemplatePath(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid generic workload %q: %w", entry, err)
+		}
+
+		workloads = append(workloads, GenericWorkload{Resource: *gvr, TemplatePath: templatePath})
+	}
+
+	return workloads, nil
+}
+
+// Name returns the controller name, e.g. rollouts.argoproj.io
+func (g GenericWorkload) Name() string {
+	return g.Resource.Resource + "." + g.Resource.Group
+}
+
+// newGenericWatcher watches the custom resource through the dynamic client and patches it with JSON patches
+func newGenericWatcher(
+	generic GenericWorkload,
+	ctx context.Context,
+	opt *RunOptions,
+	dynamicClient dynamic.Interface,
+	stopCh chan struct{},
+	logger interfaces.ILogger,
+	recorder record.EventRecorder,
+	imageNotifier interfaces.IImageNotifier,
+	rolloutDeadline time.Duration,
+	annotationSource interfaces.IAnnotationSource,
+) *controller.Controller {
+
+	client := dynamicClient.Resource(generic.Resource)
+
+	listWatcher := &cache.ListWatch{
+		ListFunc: func(options metaV1.ListOptions) (pkgRuntime.Object, error) {
+			options.LabelSelector = opt.ControllerWatchKey
+			return client.Namespace(opt.ControllerWatchNamespace).List(ctx, options)
+		},
+		WatchFunc: func(options metaV1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = opt.ControllerWatchKey
+			return client.Namespace(opt.ControllerWatchNamespace).Watch(ctx, options)
+		},
+	}
+
+	transform := func(obj interface{}) (interface{}, error) {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			return &util.GenericWorkload{Unstructured: u, TemplatePath: generic.TemplatePath}, nil
+		}
+		return obj, nil
+	}
+
+	applyJSONPatch := func(namespace string, name string, data []byte, dryRun bool) error {
+		_, err := client.Namespace(namespace).Patch(ctx, name, types.JSONPatchType, data, getPatchOptions(dryRun))
+		return err
+	}
+
+	return newWatcher(generic.Name(), stopCh, logger, recorder, listWatcher, &unstructured.Unstructured{}, imageNotifier, opt.ControllerWatchKey, applyJSONPatch, rolloutDeadline, opt.DryRun, annotationSource, transform)
+}
@@ -0,0 +1,41 @@
+package watcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/controller"
+	"github.com/pubg/kube-image-deployer/imageNotifier"
+)
+
+// livenessTimeout imageNotifier의 dispatch loop가 이 시간 이상 실행되지 않으면 멈춘 것으로 본다.
+const livenessTimeout = time.Minute
+
+// Health reports the readiness and liveness of the running watchers
+type Health struct {
+	controllers   []*controller.Controller
+	imageNotifier *imageNotifier.ImageNotifier
+}
+
+// Ready returns an error until every enabled controller has synced its informer cache
+func (h *Health) Ready() error {
+	for _, c := range h.controllers {
+		if !c.HasSynced() {
+			return fmt.Errorf("[%s] informer cache not synced", c.GetReresourceName())
+		}
+	}
+	return nil
+}
+
+// Alive returns an error if the imageNotifier poll loop has stopped making progress,
+// or no image check has completed within the check stall timeout.
+// A follower that has not started the poll loop is considered alive.
+func (h *Health) Alive() error {
+	if lastTick := h.imageNotifier.GetLastTick(); !lastTick.IsZero() && time.Since(lastTick) > livenessTimeout {
+		return fmt.Errorf("imageNotifier poll loop stalled, lastTick=%s", lastTick.Format(time.RFC3339))
+	}
+	if lastCheck := h.imageNotifier.GetLastCheck(); !lastCheck.IsZero() && time.Since(lastCheck) > h.imageNotifier.GetCheckStallTimeout() {
+		return fmt.Errorf("imageNotifier checks stalled, lastCheck=%s", lastCheck.Format(time.RFC3339))
+	}
+	return nil
+}
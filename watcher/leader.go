@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/pubg/kube-image-deployer/interfaces"
+	pkgRuntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// runLeaderElection blocks until ctx is canceled and calls onStartedLeading once this replica acquires the lease.
+// Losing the lease exits the process so that the replica restarts as a follower.
+func runLeaderElection(opt *RunOptions, ctx context.Context, clientset *kubernetes.Clientset, logger interfaces.ILogger, onStartedLeading func()) {
+
+	identity, err := os.Hostname()
+	if err != nil {
+		klog.Fatalf("Error getting hostname for leader election: %s", err.Error())
+	}
+
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		opt.LeaderElectLeaseNamespace,
+		opt.LeaderElectLeaseName,
+		clientset.CoreV1(),
+		clientset.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity},
+	)
+	if err != nil {
+		klog.Fatalf("Error creating leader election lock: %s", err.Error())
+	}
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   time.Second * time.Duration(opt.LeaderElectLeaseDurationSec),
+		RenewDeadline:   time.Second * time.Duration(opt.LeaderElectRenewDeadlineSec),
+		RetryPeriod:     time.Second * time.Duration(opt.LeaderElectRetryPeriodSec),
+		ReleaseOnCancel: true,
+		Name:            opt.LeaderElectLeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logger.Infof("leader election: %s started leading lease=%s/%s", identity, opt.LeaderElectLeaseNamespace, opt.LeaderElectLeaseName)
+				onStartedLeading()
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil { // shutting down
+					return
+				}
+				klog.Fatalf("leader election: %s lost lease=%s/%s", identity, opt.LeaderElectLeaseNamespace, opt.LeaderElectLeaseName)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					logger.Infof("leader election: current leader is %s", leader)
+				}
+			},
+		},
+	})
+}
+
+// leaderRecorder records events only while this replica is the leader.
+// Every replica's informer syncs the same workloads, so events from followers would be duplicated per replica.
+type leaderRecorder struct {
+	record.EventRecorder
+	leading int32
+}
+
+func newLeaderRecorder(recorder record.EventRecorder) *leaderRecorder {
+	return &leaderRecorder{EventRecorder: recorder}
+}
+
+func (r *leaderRecorder) startLeading() {
+	atomic.StoreInt32(&r.leading, 1)
+}
+
+func (r *leaderRecorder) isLeading() bool {
+	return atomic.LoadInt32(&r.leading) == 1
+}
+
+func (r *leaderRecorder) Event(object pkgRuntime.Object, eventtype, reason, message string) {
+	if r.isLeading() {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r *leaderRecorder) Eventf(object pkgRuntime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.isLeading() {
+		r.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	}
+}
+
+func (r *leaderRecorder) AnnotatedEventf(object pkgRuntime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.isLeading() {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,26 @@
+package watcher
+
+import (
+	"testing"
+
+	appV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestLeaderRecorder(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	recorder := newLeaderRecorder(fake)
+	obj := &appV1.Deployment{}
+
+	recorder.Eventf(obj, coreV1.EventTypeWarning, "ContainerNotFound", "follower %s", "event")
+	if len(fake.Events) != 0 {
+		t.Fatalf("Expected: no events from a follower, Got: %d", len(fake.Events))
+	}
+
+	recorder.startLeading()
+	recorder.Eventf(obj, coreV1.EventTypeWarning, "ContainerNotFound", "leader %s", "event")
+	if event := <-fake.Events; event != "Warning ContainerNotFound leader event" {
+		t.Fatalf("Expected: leader event, Got: %s", event)
+	}
+}
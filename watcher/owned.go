@@ -0,0 +1,65 @@
+package watcher
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgRuntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// bareListWatch filters out the objects managed by a controller, e.g. Jobs of a CronJob and ReplicaSets of a Deployment.
+// Their pod template is owned by the controller, which is watched itself.
+type bareListWatch struct {
+	cache.ListerWatcher
+}
+
+func newBareListWatch(lw cache.ListerWatcher) cache.ListerWatcher {
+	return &bareListWatch{ListerWatcher: lw}
+}
+
+func (lw *bareListWatch) List(options metaV1.ListOptions) (pkgRuntime.Object, error) {
+	list, err := lw.ListerWatcher.List(options)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	bare := make([]pkgRuntime.Object, 0, len(items))
+	for _, item := range items {
+		if !isControlled(item) {
+			bare = append(bare, item)
+		}
+	}
+
+	if err := meta.SetList(list, bare); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (lw *bareListWatch) Watch(options metaV1.ListOptions) (watch.Interface, error) {
+	w, err := lw.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if event.Type == watch.Modified && isControlled(event.Object) { // adopted by a controller
+			event.Type = watch.Deleted
+		}
+		return event, !(event.Type == watch.Added && isControlled(event.Object))
+	}), nil
+}
+
+func isControlled(obj pkgRuntime.Object) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	return metaV1.GetControllerOfNoCopy(accessor) != nil
+}
@@ -3,31 +3,62 @@ package watcher
 import (
 	"context"
 	"sync"
+	"time"
 
+	"github.com/pubg/kube-image-deployer/controller"
 	"github.com/pubg/kube-image-deployer/imageNotifier"
+	"github.com/pubg/kube-image-deployer/interfaces"
 	"github.com/pubg/kube-image-deployer/logger"
+	"github.com/pubg/kube-image-deployer/metrics"
+	"github.com/pubg/kube-image-deployer/policy"
 	"github.com/pubg/kube-image-deployer/remoteRegistry/docker"
+	"github.com/pubg/kube-image-deployer/util"
 	appV1 "k8s.io/api/apps/v1"
 	batchV1 "k8s.io/api/batch/v1"
+	batchV1beta1 "k8s.io/api/batch/v1beta1"
+	coreV1 "k8s.io/api/core/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
 )
 
 type RunOptions struct {
-	OffDeployments           bool
-	OffStatefulsets          bool
-	OffDaemonsets            bool
-	OffCronjobs              bool
-	ImageStringCacheTTLSec   uint
-	ImageCheckIntervalSec    uint
-	ControllerWatchKey       string
-	ControllerWatchNamespace string
-	ImageDefaultPlatform     string
+	OffDeployments                bool
+	OffStatefulsets               bool
+	OffDaemonsets                 bool
+	OffCronjobs                   bool
+	CronJobVersion                string // util.CronJobV1 or util.CronJobV1beta1. If empty, detected by API discovery
+	ImageStringCacheTTLSec        uint
+	ImageCheckIntervalSec         uint
+	ImageResyncIntervalSec        uint
+	ImageCheckConcurrency         uint
+	ImageCheckRegistryConcurrency uint
+	ControllerWatchKey            string
+	ControllerWatchNamespace      string
+	ImageDefaultPlatform          string
+	DryRun                        bool // patches are sent as server-side dry-run and not persisted
+	RolloutDeadlineSec            uint // default rollout deadline. If 0, rollouts are not watched unless annotated
+	LeaderElect                   bool // only the leader polls registries and patches workloads
+	LeaderElectLeaseName          string
+	LeaderElectLeaseNamespace     string
+	LeaderElectLeaseDurationSec   uint
+	LeaderElectRenewDeadlineSec   uint
+	LeaderElectRetryPeriodSec     uint
+	ImagePolicy                   bool              // watch ImagePolicy custom resources in addition to workload annotations
+	GenericWorkloads              []GenericWorkload // custom resources with an embedded pod template, watched through the dynamic client
+	WatchJobs                     bool              // watch Jobs which are not owned by a CronJob
+	WatchReplicaSets              bool              // watch ReplicaSets which are not owned by a Deployment
+	UpdateStrategies              map[string]string // update strategy of jobs and replicasets, see ParseUpdateStrategies
 }
 
-func Run(opt *RunOptions, ctx context.Context, clientset *kubernetes.Clientset, stopCh chan struct{}, wg *sync.WaitGroup, logger *logger.Logger) {
+// Run starts the enabled watchers and returns their health and the imageNotifier which receives registry push notifications
+func Run(opt *RunOptions, ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, stopCh chan struct{}, wg *sync.WaitGroup, logger *logger.Logger) (*Health, *imageNotifier.ImageNotifier) {
 
 	remoteRegistry := docker.NewRemoteRegistry().WithDefaultPlatform(opt.ImageDefaultPlatform).WithLogger(logger)         // create a docker remote registry
 	imageNotifier := imageNotifier.NewImageNotifier(stopCh, remoteRegistry, opt.ImageCheckIntervalSec).WithLogger(logger) // create a imageNotifier
@@ -35,51 +66,138 @@ func Run(opt *RunOptions, ctx context.Context, clientset *kubernetes.Clientset,
 		options.LabelSelector = opt.ControllerWatchKey
 	}
 
-	if !opt.OffDeployments { // deployments watcher
-		applyStrategicMergePatch := func(namespace string, name string, data []byte) error {
-			_, err := clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, metaV1.PatchOptions{})
-			return err
-		}
+	eventBroadcaster := record.NewBroadcaster() // record Kubernetes Events on the workloads
+	eventBroadcaster.StartRecordingToSink(&typedCoreV1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	var recorder record.EventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, coreV1.EventSource{Component: opt.ControllerWatchKey})
+	go func() {
+		<-stopCh
+		eventBroadcaster.Shutdown()
+	}()
+
+	metrics.RegisterCache("image", remoteRegistry.GetCache())
+	imageNotifier.WithResyncInterval(opt.ImageResyncIntervalSec)
+	imageNotifier.WithConcurrency(opt.ImageCheckConcurrency, opt.ImageCheckRegistryConcurrency)
+
+	if opt.LeaderElect { // followers keep informers warm and start polling and recording events when they become the leader
+		leaderRecorder := newLeaderRecorder(recorder)
+		recorder = leaderRecorder
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			newWatcher("deployments", stopCh, logger, cache.NewFilteredListWatchFromClient(clientset.AppsV1().RESTClient(), "deployments", opt.ControllerWatchNamespace, optionsModifier), &appV1.Deployment{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch)
+			runLeaderElection(opt, ctx, clientset, logger, func() {
+				leaderRecorder.startLeading()
+				imageNotifier.Start()
+			})
 		}()
+	} else {
+		imageNotifier.Start()
 	}
 
-	if !opt.OffStatefulsets { // statefulsets watcher
-		applyStrategicMergePatch := func(namespace string, name string, data []byte) error {
-			_, err := clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, metaV1.PatchOptions{})
-			return err
-		}
+	rolloutDeadline := time.Second * time.Duration(opt.RolloutDeadlineSec)
+
+	health := &Health{imageNotifier: imageNotifier}
+
+	var annotationSource interfaces.IAnnotationSource
+	var policyStore *policy.Store
+	if opt.ImagePolicy { // ImagePolicy selects workloads and provides their annotations
+		policyStore = policy.NewStore(dynamicClient, opt.ControllerWatchKey).WithLogger(logger)
+		annotationSource = policyStore
+	}
+	runController := func(c *controller.Controller) {
+		health.controllers = append(health.controllers, c)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			newWatcher("statefulsets", stopCh, logger, cache.NewFilteredListWatchFromClient(clientset.AppsV1().RESTClient(), "statefulsets", opt.ControllerWatchNamespace, optionsModifier), &appV1.StatefulSet{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch)
+			RunController(stopCh, c)
 		}()
 	}
 
+	if !opt.OffDeployments { // deployments watcher
+		applyStrategicMergePatch := func(namespace string, name string, data []byte, dryRun bool) error {
+			_, err := clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, getPatchOptions(dryRun))
+			return err
+		}
+		runController(newWatcher("deployments", stopCh, logger, recorder, cache.NewFilteredListWatchFromClient(clientset.AppsV1().RESTClient(), "deployments", opt.ControllerWatchNamespace, optionsModifier), &appV1.Deployment{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch, rolloutDeadline, opt.DryRun, annotationSource, nil))
+	}
+
+	if !opt.OffStatefulsets { // statefulsets watcher
+		applyStrategicMergePatch := func(namespace string, name string, data []byte, dryRun bool) error {
+			_, err := clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, getPatchOptions(dryRun))
+			return err
+		}
+		runController(newWatcher("statefulsets", stopCh, logger, recorder, cache.NewFilteredListWatchFromClient(clientset.AppsV1().RESTClient(), "statefulsets", opt.ControllerWatchNamespace, optionsModifier), &appV1.StatefulSet{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch, rolloutDeadline, opt.DryRun, annotationSource, nil))
+	}
+
 	if !opt.OffDaemonsets { // daemonsets watcher
-		applyStrategicMergePatch := func(namespace string, name string, data []byte) error {
-			_, err := clientset.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, metaV1.PatchOptions{})
+		applyStrategicMergePatch := func(namespace string, name string, data []byte, dryRun bool) error {
+			_, err := clientset.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, getPatchOptions(dryRun))
 			return err
 		}
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			newWatcher("daemonsets", stopCh, logger, cache.NewFilteredListWatchFromClient(clientset.AppsV1().RESTClient(), "daemonsets", opt.ControllerWatchNamespace, optionsModifier), &appV1.DaemonSet{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch)
-		}()
+		runController(newWatcher("daemonsets", stopCh, logger, recorder, cache.NewFilteredListWatchFromClient(clientset.AppsV1().RESTClient(), "daemonsets", opt.ControllerWatchNamespace, optionsModifier), &appV1.DaemonSet{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch, rolloutDeadline, opt.DryRun, annotationSource, nil))
 	}
 
 	if !opt.OffCronjobs { // cronjobs watcher
-		applyStrategicMergePatch := func(namespace string, name string, data []byte) error {
-			_, err := clientset.BatchV1().CronJobs(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, metaV1.PatchOptions{})
-			return err
+		cronJobVersion := opt.CronJobVersion
+		if cronJobVersion == "" {
+			version, err := util.DetectCronJobVersion(clientset.Discovery())
+			if err != nil {
+				klog.Fatalf("Error detecting the CronJob API version: %s", err.Error())
+			}
+			cronJobVersion = version
+		}
+		logger.Infof("cronjobs watcher uses batch/%s", cronJobVersion)
+
+		if cronJobVersion == util.CronJobV1beta1 { // Kubernetes 1.20 and older
+			applyStrategicMergePatch := func(namespace string, name string, data []byte, dryRun bool) error {
+				_, err := clientset.BatchV1beta1().CronJobs(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, getPatchOptions(dryRun))
+				return err
+			}
+			runController(newWatcher("cronjobs", stopCh, logger, recorder, cache.NewFilteredListWatchFromClient(clientset.BatchV1beta1().RESTClient(), "cronjobs", opt.ControllerWatchNamespace, optionsModifier), &batchV1beta1.CronJob{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch, rolloutDeadline, opt.DryRun, annotationSource, nil))
+		} else {
+			applyStrategicMergePatch := func(namespace string, name string, data []byte, dryRun bool) error {
+				_, err := clientset.BatchV1().CronJobs(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, getPatchOptions(dryRun))
+				return err
+			}
+			runController(newWatcher("cronjobs", stopCh, logger, recorder, cache.NewFilteredListWatchFromClient(clientset.BatchV1().RESTClient(), "cronjobs", opt.ControllerWatchNamespace, optionsModifier), &batchV1.CronJob{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch, rolloutDeadline, opt.DryRun, annotationSource, nil))
+		}
+	}
+
+	if opt.UpdateStrategies == nil {
+		opt.UpdateStrategies, _ = ParseUpdateStrategies("") // defaults
+	}
+
+	if opt.WatchJobs { // bare jobs watcher
+		applyStrategicMergePatch := newJobApply(ctx, clientset, opt.ControllerWatchKey, opt.UpdateStrategies["jobs"])
+		runController(newWatcher("jobs", stopCh, logger, recorder, newBareListWatch(cache.NewFilteredListWatchFromClient(clientset.BatchV1().RESTClient(), "jobs", opt.ControllerWatchNamespace, optionsModifier)), &batchV1.Job{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch, rolloutDeadline, opt.DryRun, annotationSource, nil))
+	}
+
+	if opt.WatchReplicaSets { // bare replicasets watcher
+		applyStrategicMergePatch := newReplicaSetApply(ctx, clientset, opt.UpdateStrategies["replicasets"])
+		runController(newWatcher("replicasets", stopCh, logger, recorder, newBareListWatch(cache.NewFilteredListWatchFromClient(clientset.AppsV1().RESTClient(), "replicasets", opt.ControllerWatchNamespace, optionsModifier)), &appV1.ReplicaSet{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch, rolloutDeadline, opt.DryRun, annotationSource, nil))
+	}
+
+	for _, generic := range opt.GenericWorkloads { // custom resource watchers
+		runController(newGenericWatcher(generic, ctx, opt, dynamicClient, stopCh, logger, recorder, imageNotifier, rolloutDeadline, annotationSource))
+	}
+
+	if policyStore != nil {
+		for _, c := range health.controllers {
+			policyStore.OnChange(c.ResyncAll)
 		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			newWatcher("cronjobs", stopCh, logger, cache.NewFilteredListWatchFromClient(clientset.BatchV1().RESTClient(), "cronjobs", opt.ControllerWatchNamespace, optionsModifier), &batchV1.CronJob{}, imageNotifier, opt.ControllerWatchKey, applyStrategicMergePatch)
+			policyStore.Run(stopCh)
 		}()
 	}
+
+	return health, imageNotifier
+}
+
+// getPatchOptions returns the patch options. A dry-run patch is validated by the API server but not persisted
+func getPatchOptions(dryRun bool) metaV1.PatchOptions {
+	if dryRun {
+		return metaV1.PatchOptions{DryRun: []string{metaV1.DryRunAll}}
+	}
+	return metaV1.PatchOptions{}
 }
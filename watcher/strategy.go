@@ -0,0 +1,205 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pubg/kube-image-deployer/controller"
+	"github.com/pubg/kube-image-deployer/util"
+	appV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// update strategies of the jobs and replicasets watchers
+const (
+	StrategyPatch     = "patch"     // strategic merge patch on the workload
+	StrategyRecreate  = "recreate"  // delete the workload and create it again with the patched spec
+	StrategyConfigMap = "configmap" // patch the Job template in the ConfigMap named by <watchKey>.settings/template-configmap. The existing Job is not changed
+)
+
+// updateStrategies supported strategies per resource. The first one is the default
+var updateStrategies = map[string][]string{
+	"jobs":        {StrategyRecreate, StrategyConfigMap, StrategyPatch}, // the pod template of a Job is immutable
+	"replicasets": {StrategyPatch, StrategyRecreate},                    // a patch only changes the pods created afterwards
+}
+
+// ParseUpdateStrategies parses comma separated "<resource>=<strategy>" entries, e.g. jobs=configmap,replicasets=recreate
+// Resources which are not given use their default strategy.
+func ParseUpdateStrategies(value string) (map[string]string, error) {
+	strategies := make(map[string]string)
+	for resource, supported := range updateStrategies {
+		strategies[resource] = supported[0]
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kv := strings.SplitN(entry, "=", 2)
+		supported, ok := updateStrategies[kv[0]]
+		if len(kv) != 2 || !ok {
+			return nil, fmt.Errorf("invalid update strategy %q: expected jobs=<strategy> or replicasets=<strategy>", entry)
+		}
+
+		valid := false
+		for _, strategy := range supported {
+			valid = valid || strategy == kv[1]
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid update strategy %q: %s supports %s", entry, kv[0], strings.Join(supported, ", "))
+		}
+
+		strategies[kv[0]] = kv[1]
+	}
+
+	return strategies, nil
+}
+
+// newJobApply returns the function which applies the image patch to a Job with the strategy
+func newJobApply(ctx context.Context, clientset *kubernetes.Clientset, watchKey string, strategy string) ApplyStrategicMergePatch {
+	return func(namespace string, name string, data []byte, dryRun bool) error {
+		jobs := clientset.BatchV1().Jobs(namespace)
+
+		if strategy == StrategyPatch {
+			_, err := jobs.Patch(ctx, name, types.StrategicMergePatchType, data, getPatchOptions(dryRun))
+			return err
+		}
+
+		job, err := jobs.Get(ctx, name, metaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if strategy == StrategyConfigMap {
+			templateConfigMap, _ := controller.GetSetting(job, job.Annotations, watchKey, controller.TemplateConfigMapSetting)
+			return patchJobTemplateConfigMap(ctx, clientset, namespace, templateConfigMap, data, dryRun)
+		}
+
+		patched := &batchV1.Job{}
+		if err := util.ApplyPatchLocally(job, data, patched); err != nil {
+			return err
+		}
+		util.CleanJobForRecreate(patched)
+
+		return util.Recreate(ctx, job.UID, dryRun,
+			func(options metaV1.DeleteOptions) error { return jobs.Delete(ctx, name, options) },
+			func() error { _, err := jobs.Get(ctx, name, metaV1.GetOptions{}); return err },
+			func() error { _, err := jobs.Create(ctx, patched, metaV1.CreateOptions{}); return err },
+		)
+	}
+}
+
+// newReplicaSetApply returns the function which applies the image patch to a ReplicaSet with the strategy
+func newReplicaSetApply(ctx context.Context, clientset *kubernetes.Clientset, strategy string) ApplyStrategicMergePatch {
+	return func(namespace string, name string, data []byte, dryRun bool) error {
+		replicaSets := clientset.AppsV1().ReplicaSets(namespace)
+
+		if strategy == StrategyPatch {
+			_, err := replicaSets.Patch(ctx, name, types.StrategicMergePatchType, data, getPatchOptions(dryRun))
+			return err
+		}
+
+		replicaSet, err := replicaSets.Get(ctx, name, metaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		patched := &appV1.ReplicaSet{}
+		if err := util.ApplyPatchLocally(replicaSet, data, patched); err != nil {
+			return err
+		}
+		patched.ObjectMeta = metaV1.ObjectMeta{Name: patched.Name, Namespace: patched.Namespace, Labels: patched.Labels, Annotations: patched.Annotations}
+		patched.Status = appV1.ReplicaSetStatus{}
+
+		return util.Recreate(ctx, replicaSet.UID, dryRun,
+			func(options metaV1.DeleteOptions) error { return replicaSets.Delete(ctx, name, options) },
+			func() error { _, err := replicaSets.Get(ctx, name, metaV1.GetOptions{}); return err },
+			func() error { _, err := replicaSets.Create(ctx, patched, metaV1.CreateOptions{}); return err },
+		)
+	}
+}
+
+// patchJobTemplateConfigMap applies the patch to the Job manifest in the ConfigMap, given as <configMap>/<key>.
+// The next Job created from the manifest uses the new images. The manifest is rewritten as YAML.
+func patchJobTemplateConfigMap(ctx context.Context, clientset *kubernetes.Clientset, namespace string, templateConfigMap string, data []byte, dryRun bool) error {
+	configMapName, key, ok := strings.Cut(templateConfigMap, "/")
+	if !ok || configMapName == "" || key == "" {
+		return fmt.Errorf("invalid %s annotation %q: expected <configMap>/<key>", controller.TemplateConfigMapSetting, templateConfigMap)
+	}
+
+	configMaps := clientset.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(ctx, configMapName, metaV1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	manifest, ok := configMap.Data[key]
+	if !ok {
+		return fmt.Errorf("key %s not found in configmap %s", key, configMapName)
+	}
+
+	templateJson, err := yaml.YAMLToJSON([]byte(manifest))
+	if err != nil {
+		return err
+	}
+
+	template := &batchV1.Job{}
+	if err := json.Unmarshal(templateJson, template); err != nil {
+		return err
+	}
+
+	patched := &batchV1.Job{}
+	if err := util.ApplyPatchLocally(template, data, patched); err != nil {
+		return err
+	}
+
+	if hasSameImages(template, patched) { // already updated. history annotation만 바뀌는 update를 하지 않는다.
+		return nil
+	}
+
+	patchedYaml, err := yaml.Marshal(patched)
+	if err != nil {
+		return err
+	}
+
+	configMap.Data[key] = string(patchedYaml)
+	updateOptions := metaV1.UpdateOptions{}
+	if dryRun {
+		updateOptions.DryRun = []string{metaV1.DryRunAll}
+	}
+	_, err = configMaps.Update(ctx, configMap, updateOptions)
+	return err
+}
+
+func hasSameImages(a, b *batchV1.Job) bool {
+	images := func(job *batchV1.Job) []string {
+		result := make([]string, 0)
+		for _, getContainers := range []func(interface{}) ([]coreV1.Container, error){util.GetContainers, util.GetInitContainers} {
+			containers, _ := getContainers(job)
+			for _, container := range containers {
+				result = append(result, container.Name+"="+container.Image)
+			}
+		}
+		return result
+	}
+
+	imagesA, imagesB := images(a), images(b)
+	if len(imagesA) != len(imagesB) {
+		return false
+	}
+	for i := range imagesA {
+		if imagesA[i] != imagesB[i] {
+			return false
+		}
+	}
+	return true
+}
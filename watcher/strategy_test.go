@@ -0,0 +1,19 @@
+package watcher
+
+import "testing"
+
+func TestParseUpdateStrategies(t *testing.T) {
+	strategies, err := ParseUpdateStrategies("jobs=configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strategies["jobs"] != StrategyConfigMap || strategies["replicasets"] != StrategyPatch {
+		t.Errorf("Expected: jobs=configmap, replicasets=patch, Got: %v", strategies)
+	}
+
+	for _, value := range []string{"jobs", "pods=patch", "replicasets=configmap"} {
+		if _, err := ParseUpdateStrategies(value); err == nil {
+			t.Errorf("Expected: error for %q", value)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package watcher
 
 import (
+	"time"
+
 	"github.com/pubg/kube-image-deployer/controller"
 	"github.com/pubg/kube-image-deployer/interfaces"
 	l "github.com/pubg/kube-image-deployer/logger"
 	pkgRuntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
@@ -15,14 +18,18 @@ func newWatcher(
 	name string,
 	stop chan struct{},
 	logger interfaces.ILogger,
+	recorder record.EventRecorder,
 	listWatcher cache.ListerWatcher,
 	objType pkgRuntime.Object,
 	imageNotifier interfaces.IImageNotifier,
 	controllerWatchKey string,
 	applyStrategicMergePatch ApplyStrategicMergePatch,
-) {
-	controller := createDefaultController(name, stop, logger, listWatcher, objType, imageNotifier, controllerWatchKey, applyStrategicMergePatch)
-	RunController(stop, controller)
+	rolloutDeadline time.Duration,
+	dryRun bool,
+	annotationSource interfaces.IAnnotationSource,
+	transform cache.TransformFunc,
+) *controller.Controller {
+	return createDefaultController(name, stop, logger, recorder, listWatcher, objType, imageNotifier, controllerWatchKey, applyStrategicMergePatch, rolloutDeadline, dryRun, annotationSource, transform)
 }
 
 func RunController(
@@ -36,21 +43,27 @@ func createDefaultController(
 	name string,
 	stop chan struct{},
 	logger interfaces.ILogger,
+	recorder record.EventRecorder,
 	listWatcher cache.ListerWatcher,
 	objType pkgRuntime.Object,
 	imageNotifier interfaces.IImageNotifier,
 	controllerWatchKey string,
 	applyStrategicMergePatch ApplyStrategicMergePatch,
+	rolloutDeadline time.Duration,
+	dryRun bool,
+	annotationSource interfaces.IAnnotationSource,
+	transform cache.TransformFunc,
 ) *controller.Controller {
 
 	// create the workqueue
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name)
 
 	// Bind the workqueue to a cache with the help of an informer. This way we make sure that
 	// whenever the cache is updated, the pod key is added to the workqueue.
 	// Note that when we finally process the item from the workqueue, we might see a newer version
 	// of the Pod than the version which was responsible for triggering the update.
-	indexer, informer := cache.NewIndexerInformer(listWatcher, objType, 0, cache.ResourceEventHandlerFuncs{
+	// transform converts the listed objects before they are stored, e.g. wraps unstructured objects into util.GenericWorkload
+	indexer, informer := cache.NewTransformingIndexerInformer(listWatcher, objType, 0, cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			key, err := cache.MetaNamespaceKeyFunc(obj)
 			if err == nil {
@@ -71,7 +84,7 @@ func createDefaultController(
 				queue.Add(key)
 			}
 		},
-	}, cache.Indexers{})
+	}, cache.Indexers{}, transform)
 
 	controllerOpt := controller.ControllerOpt{
 		Resource:                 name,
@@ -83,6 +96,10 @@ func createDefaultController(
 		ImageNotifier:            imageNotifier,
 		ControllerWatchKey:       controllerWatchKey,
 		Logger:                   logger,
+		Recorder:                 recorder,
+		RolloutDeadline:          rolloutDeadline,
+		DryRun:                   dryRun,
+		AnnotationSource:         annotationSource,
 	}
 
 	if controllerOpt.Logger == nil {
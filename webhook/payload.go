@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// push event source label values
+const (
+	SourceDockerHub    = "dockerhub"
+	SourceHarbor       = "harbor"
+	SourceDistribution = "distribution"
+	SourceECR          = "ecr"
+)
+
+// pushEvent registry에 push된 repository와 tag
+type pushEvent struct {
+	repository string
+	tag        string
+}
+
+// payload 지원하는 registry 알림 형식의 필드를 모두 포함한다. 채워진 필드로 source를 구분한다.
+type payload struct {
+	// Docker Hub
+	PushData *struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository *struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+
+	// Harbor
+	Type      string `json:"type"`
+	EventData *struct {
+		Resources []struct {
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+	} `json:"event_data"`
+
+	// CNCF distribution
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+
+	// ECR via EventBridge
+	Source  string `json:"source"`
+	Account string `json:"account"`
+	Region  string `json:"region"`
+	Detail  *struct {
+		ActionType     string `json:"action-type"`
+		Result         string `json:"result"`
+		RepositoryName string `json:"repository-name"`
+		ImageTag       string `json:"image-tag"`
+	} `json:"detail"`
+}
+
+// parsePushEvents registry 알림에서 push event를 추출한다. push가 아닌 알림은 빈 목록을 반환한다.
+func parsePushEvents(body []byte) (source string, events []pushEvent, err error) {
+	p := payload{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return "", nil, err
+	}
+
+	events = make([]pushEvent, 0)
+
+	switch {
+	case p.Source == "aws.ecr" && p.Detail != nil:
+		if p.Detail.ActionType == "PUSH" && p.Detail.Result == "SUCCESS" {
+			repository := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", p.Account, p.Region, p.Detail.RepositoryName)
+			events = append(events, pushEvent{repository: repository, tag: p.Detail.ImageTag})
+		}
+		return SourceECR, events, nil
+
+	case p.EventData != nil:
+		if p.Type == "PUSH_ARTIFACT" || p.Type == "pushImage" {
+			for _, resource := range p.EventData.Resources {
+				repository := strings.TrimSuffix(resource.ResourceURL, ":"+resource.Tag)
+				if idx := strings.Index(repository, "@"); idx >= 0 { // digest로 push된 경우
+					repository = repository[:idx]
+				}
+				events = append(events, pushEvent{repository: repository, tag: resource.Tag})
+			}
+		}
+		return SourceHarbor, events, nil
+
+	case p.PushData != nil && p.Repository != nil:
+		events = append(events, pushEvent{repository: p.Repository.RepoName, tag: p.PushData.Tag})
+		return SourceDockerHub, events, nil
+
+	case p.Events != nil:
+		for _, event := range p.Events {
+			if event.Action != "push" || event.Target.Tag == "" { // blob, digest push는 tag가 없다.
+				continue
+			}
+			events = append(events, pushEvent{repository: event.Request.Host + "/" + event.Target.Repository, tag: event.Target.Tag})
+		}
+		return SourceDistribution, events, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown payload")
+}
@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pubg/kube-image-deployer/interfaces"
+	l "github.com/pubg/kube-image-deployer/logger"
+	"github.com/pubg/kube-image-deployer/metrics"
+)
+
+// maxBodySize registry 알림 body 크기 제한
+const maxBodySize = 1 << 20
+
+// INotifier push된 repository:tag를 즉시 check 한다.
+type INotifier interface {
+	NotifyPush(repository, tag string) (int, error)
+}
+
+// Handler registry push 알림을 받아 해당 image를 즉시 check 하도록 notifier에 전달한다.
+// Docker Hub, Harbor, CNCF distribution, EventBridge로 전달된 ECR 알림을 지원한다.
+type Handler struct {
+	notifier   INotifier
+	token      string
+	hmacSecret string
+	logger     interfaces.ILogger
+}
+
+func NewHandler(notifier INotifier) *Handler {
+	return &Handler{
+		notifier: notifier,
+		logger:   l.NewLogger(),
+	}
+}
+
+func (h *Handler) WithLogger(logger interfaces.ILogger) *Handler {
+	h.logger = logger
+	return h
+}
+
+// WithToken "Authorization: Bearer <token>", "Authorization: <token>" header 또는 ?token=<token> query를 허용한다.
+// Docker Hub처럼 header를 지정할 수 없는 registry는 query를 사용한다.
+func (h *Handler) WithToken(token string) *Handler {
+	h.token = token
+	return h
+}
+
+// WithHMACSecret "X-Signature-256: sha256=<hex>" header의 body HMAC-SHA256 서명을 허용한다.
+func (h *Handler) WithHMACSecret(secret string) *Handler {
+	h.hmacSecret = secret
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.authorize(r, body) {
+		metrics.AddWebhookRequest("", metrics.WebhookUnauthorized)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	source, events, err := parsePushEvents(body)
+	if err != nil {
+		h.logger.Warningf("webhook invalid payload from %s, err=%s\n", r.RemoteAddr, err)
+		metrics.AddWebhookRequest("", metrics.WebhookInvalid)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accepted := 0
+	for _, event := range events {
+		h.logger.Infof("webhook %s push %s:%s\n", source, event.repository, event.tag)
+		if _, err := h.notifier.NotifyPush(event.repository, event.tag); err != nil { // 잘못된 event는 건너뛰고 나머지를 처리한다.
+			h.logger.Warningf("webhook %s push %s:%s skipped, err=%s\n", source, event.repository, event.tag, err)
+			continue
+		}
+		accepted++
+	}
+
+	if len(events) == 0 { // pull, delete 등 push가 아닌 event만 있는 payload. registry가 재시도하지 않도록 2xx를 반환한다.
+		metrics.AddWebhookRequest(source, metrics.WebhookIgnored)
+		w.Write([]byte("ok"))
+		return
+	} else if accepted == 0 { // 모든 push event의 repository가 잘못되어 재시도해도 처리할 수 없는 payload
+		metrics.AddWebhookRequest(source, metrics.WebhookInvalid)
+		http.Error(w, "no valid push event", http.StatusBadRequest)
+		return
+	}
+
+	metrics.AddWebhookRequest(source, metrics.WebhookAccepted)
+	w.Write([]byte("ok"))
+}
+
+// authorize token 또는 HMAC 서명 중 설정된 방식 하나라도 일치하면 true를 반환한다.
+func (h *Handler) authorize(r *http.Request, body []byte) bool {
+	if h.token != "" {
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1 {
+			return true
+		}
+	}
+
+	if h.hmacSecret != "" {
+		signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get("X-Signature-256"), "sha256="))
+		if err == nil && len(signature) > 0 {
+			mac := hmac.New(sha256.New, []byte(h.hmacSecret))
+			mac.Write(body)
+			if hmac.Equal(signature, mac.Sum(nil)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testNotifier struct {
+	pushed []string
+}
+
+func (n *testNotifier) NotifyPush(repository, tag string) (int, error) {
+	if strings.Contains(repository, "invalid/") {
+		return 0, errors.New("invalid repository")
+	}
+	n.pushed = append(n.pushed, repository+":"+tag)
+	return 1, nil
+}
+
+func TestParsePushEvents(t *testing.T) {
+	tests := []struct {
+		body       string
+		source     string
+		repository string
+		tag        string
+	}{
+		{`{"push_data":{"tag":"latest","pusher":"user"},"repository":{"repo_name":"user/app","namespace":"user","name":"app"}}`, SourceDockerHub, "user/app", "latest"},
+		{`{"type":"PUSH_ARTIFACT","occur_at":1680000000,"event_data":{"resources":[{"digest":"sha256:1","tag":"v1","resource_url":"harbor.example.com/library/app:v1"}],"repository":{"repo_full_name":"library/app"}}}`, SourceHarbor, "harbor.example.com/library/app", "v1"},
+		{`{"events":[{"action":"push","target":{"mediaType":"application/octet-stream","repository":"team/app"},"request":{"host":"registry.example.com:5000"}},{"action":"push","target":{"repository":"team/app","tag":"1.2.0"},"request":{"host":"registry.example.com:5000"}}]}`, SourceDistribution, "registry.example.com:5000/team/app", "1.2.0"},
+		{`{"source":"aws.ecr","detail-type":"ECR Image Action","account":"123456789012","region":"ap-northeast-2","detail":{"action-type":"PUSH","result":"SUCCESS","repository-name":"team/app","image-tag":"latest"}}`, SourceECR, "123456789012.dkr.ecr.ap-northeast-2.amazonaws.com/team/app", "latest"},
+	}
+
+	for _, test := range tests {
+		source, events, err := parsePushEvents([]byte(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source != test.source || len(events) != 1 || events[0].repository != test.repository || events[0].tag != test.tag {
+			t.Fatalf("Expected: %s %s:%s, Got: %s %+v", test.source, test.repository, test.tag, source, events)
+		}
+	}
+
+	if _, _, err := parsePushEvents([]byte(`{"hello":"world"}`)); err == nil {
+		t.Fatalf("Expected: unknown payload error")
+	}
+}
+
+func TestHandlerAuthorize(t *testing.T) {
+	body := `{"push_data":{"tag":"latest"},"repository":{"repo_name":"user/app"}}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		target string
+		header map[string]string
+		code   int
+	}{
+		{"/webhook", nil, http.StatusUnauthorized},
+		{"/webhook?token=wrong", nil, http.StatusUnauthorized},
+		{"/webhook?token=token", nil, http.StatusOK},
+		{"/webhook", map[string]string{"Authorization": "Bearer token"}, http.StatusOK},
+		{"/webhook", map[string]string{"Authorization": "token"}, http.StatusOK},
+		{"/webhook", map[string]string{"X-Signature-256": signature}, http.StatusOK},
+		{"/webhook", map[string]string{"X-Signature-256": "sha256=00"}, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		notifier := &testNotifier{}
+		h := NewHandler(notifier).WithToken("token").WithHMACSecret("secret")
+
+		r := httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(body))
+		for k, v := range test.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Fatalf("%s %v Expected: %d, Got: %d", test.target, test.header, test.code, w.Code)
+		}
+		if test.code == http.StatusOK && (len(notifier.pushed) != 1 || notifier.pushed[0] != "user/app:latest") {
+			t.Fatalf("Expected: user/app:latest pushed, Got: %v", notifier.pushed)
+		}
+	}
+}
+
+// 잘못된 event는 건너뛰고 나머지 event를 처리해야 한다. push event가 모두 잘못되었으면 400, push event가 없으면 200을 반환한다.
+func TestHandlerInvalidEvents(t *testing.T) {
+	tests := []struct {
+		body   string
+		code   int
+		pushed int
+	}{
+		{`{"events":[{"action":"push","target":{"repository":"invalid/app","tag":"1"}},{"action":"push","target":{"repository":"team/app","tag":"2"},"request":{"host":"registry.example.com"}}]}`, http.StatusOK, 1},
+		{`{"events":[{"action":"push","target":{"repository":"invalid/app","tag":"1"}}]}`, http.StatusBadRequest, 0},
+		{`{"events":[{"action":"pull","target":{"repository":"team/app","tag":"1"}}]}`, http.StatusOK, 0},
+		{`{"type":"DELETE_ARTIFACT","event_data":{"resources":[{"tag":"1"}],"repository":{"repo_full_name":"team/app"}}}`, http.StatusOK, 0},
+		{`{"source":"aws.ecr","detail-type":"ECR Image Action","account":"123456789012","region":"ap-northeast-2","detail":{"action-type":"DELETE","result":"SUCCESS","repository-name":"app","image-tag":"1"}}`, http.StatusOK, 0},
+		{`not json`, http.StatusBadRequest, 0},
+	}
+
+	for _, test := range tests {
+		notifier := &testNotifier{}
+		h := NewHandler(notifier).WithToken("token")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook?token=token", strings.NewReader(test.body)))
+
+		if w.Code != test.code || len(notifier.pushed) != test.pushed {
+			t.Fatalf("Expected: %d, %d pushed, Got: %d, %v", test.code, test.pushed, w.Code, notifier.pushed)
+		}
+	}
+}